@@ -37,13 +37,11 @@ func init() {
 }
 
 func addFriend(_ *cobra.Command, _ []string) {
-	_, username, password, friendName, vogoServer := viper.GetBool("debug"),
-		viper.GetString("user.name"),
-		viper.GetString("user.password"),
+	_, friendName, vogoServer := viper.GetBool("debug"),
 		viper.GetString("friendName"),
 		viper.GetString("servers.vogo-origin")
 
-	vogoClient := crud.NewClient(vogoServer, username, password)
+	vogoClient := crud.NewClient(vogoServer, sessionToken())
 	friend, err := crud.AddFriend(vogoClient, friendName)
 	if err != nil {
 		log.Fatal(fmt.Errorf("error adding friend: %w", err).Error())
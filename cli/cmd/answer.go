@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
@@ -18,15 +19,16 @@ var answerCmd = &cobra.Command{
 	Short: "Answer a call from a friend",
 	Long: `Arguments:
       name    The username of the friend to answer (required)
+
+Press enter during the call to mute or unmute your microphone.
+
+Audio is captured from the default microphone and played on the default speaker, unless
+--input or --output is given a WAV file (16-bit PCM, 48 kHz stereo), or "null" for silence.
 	`,
 	Args: cobra.ExactArgs(1),
 	PreRunE: func(_ *cobra.Command, args []string) error {
-		username, password := viper.GetString("user.name"), viper.GetString("user.password")
-		if len(username) == 0 {
-			return fmt.Errorf("username not found. ensure it is present in %s", ConfigFile)
-		}
-		if len(password) == 0 {
-			return fmt.Errorf("password not found. ensure it is present in %s", ConfigFile)
+		if err := checkSession(); err != nil {
+			return err
 		}
 
 		if len(args) == 0 {
@@ -45,23 +47,49 @@ var answerCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(answerCmd)
+
+	answerCmd.Flags().String("input", "", `WAV file to send instead of the microphone's audio, or "null" to send silence`)
+	answerCmd.Flags().String("output", "", `WAV file to record the call to instead of playing it, or "null" to discard it`)
+	_ = viper.BindPFlag("answerInput", answerCmd.Flags().Lookup("input"))
+	_ = viper.BindPFlag("answerOutput", answerCmd.Flags().Lookup("output"))
 }
 
 func answerCall(_ *cobra.Command, _ []string) {
-	_, username, password, vogoServer, stunServer, caller := viper.GetBool("debug"),
+	debug, username, vogoServer, stunServer, caller, reconnectGrace, fec, input, output := viper.GetBool("debug"),
 		viper.GetString("user.name"),
-		viper.GetString("user.password"),
 		viper.GetString("servers.vogo-origin"),
 		viper.GetString("servers.stun-origin"),
-		viper.GetString("caller")
+		viper.GetString("caller"),
+		viper.GetDuration("calls.reconnect-grace"),
+		viper.GetBool("calls.fec"),
+		viper.GetString("answerInput"),
+		viper.GetString("answerOutput")
 
 	ctx, stop := signal.NotifyContext(context.Background(),
 		os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	credentials := netw.NewCredentials(stunServer, vogoServer, username, password)
-	err := netw.AnswerCall(ctx, credentials, caller)
-	if err != nil {
+	cert, peers := peerIdentity()
+	credentials := netw.NewCredentials(stunServer, vogoServer, username, sessionToken, cert, peers)
+	session := netw.NewAnswer(credentials, caller, reconnectGrace)
+	session.UseFEC(fec)
+	if err := startSession(ctx, session, input, output); err != nil {
 		fmt.Println(err)
+		return
+	}
+	go muteOnEnter(session)
+	printProgress(session, caller, reconnectGrace)
+
+	err := session.Wait()
+	switch {
+	case errors.Is(err, netw.ErrHungUp):
+		fmt.Printf("%s hung up\n", caller)
+	case errors.Is(err, netw.ErrConnectionLost):
+		fmt.Printf("lost connection to %s\n", caller)
+	case err != nil:
+		fmt.Println(err)
+	}
+	if debug {
+		printJitterStats(session)
 	}
 }
@@ -1,12 +1,16 @@
 package cmd
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/gregriff/vogo/cli/internal/audio"
 	"github.com/gregriff/vogo/cli/internal/netw"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -18,15 +22,16 @@ var callCmd = &cobra.Command{
 	Short: "Call a friend",
 	Long: `Arguments:
       name    The username of the friend to call (required)
+
+Press enter during the call to mute or unmute your microphone.
+
+Audio is captured from the default microphone and played on the default speaker, unless
+--input or --output is given a WAV file (16-bit PCM, 48 kHz stereo), or "null" for silence.
 	`,
 	Args: cobra.ExactArgs(1),
 	PreRunE: func(_ *cobra.Command, args []string) error {
-		username, password := viper.GetString("user.name"), viper.GetString("user.password")
-		if len(username) == 0 {
-			return fmt.Errorf("username not found. ensure it is present in %s", ConfigFile)
-		}
-		if len(password) == 0 {
-			return fmt.Errorf("password not found. ensure it is present in %s", ConfigFile)
+		if err := checkSession(); err != nil {
+			return err
 		}
 
 		if len(args) == 0 {
@@ -45,23 +50,150 @@ var callCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(callCmd)
+
+	callCmd.Flags().String("input", "", `WAV file to send instead of the microphone's audio, or "null" to send silence`)
+	callCmd.Flags().String("output", "", `WAV file to record the call to instead of playing it, or "null" to discard it`)
+	_ = viper.BindPFlag("callInput", callCmd.Flags().Lookup("input"))
+	_ = viper.BindPFlag("callOutput", callCmd.Flags().Lookup("output"))
 }
 
 func callFriend(_ *cobra.Command, _ []string) {
-	_, vogoServer, stunServer, recipient, username, password := viper.GetBool("debug"),
+	debug, vogoServer, stunServer, recipient, username, reconnectGrace, fec, input, output := viper.GetBool("debug"),
 		viper.GetString("servers.vogo-origin"),
 		viper.GetString("servers.stun-origin"),
 		viper.GetString("recipient"),
 		viper.GetString("user.name"),
-		viper.GetString("user.password")
+		viper.GetDuration("calls.reconnect-grace"),
+		viper.GetBool("calls.fec"),
+		viper.GetString("callInput"),
+		viper.GetString("callOutput")
 
 	ctx, stop := signal.NotifyContext(context.Background(),
 		os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	credentials := netw.NewCredentials(stunServer, vogoServer, username, password)
-	err := netw.CallFriend(ctx, credentials, recipient)
-	if err != nil {
+	cert, peers := peerIdentity()
+	credentials := netw.NewCredentials(stunServer, vogoServer, username, sessionToken, cert, peers)
+	session := netw.NewCall(credentials, recipient, reconnectGrace)
+	session.UseFEC(fec)
+	if err := startSession(ctx, session, input, output); err != nil {
 		fmt.Println(err)
+		return
+	}
+	go muteOnEnter(session)
+	printProgress(session, recipient, reconnectGrace)
+
+	err := session.Wait()
+	switch {
+	case errors.Is(err, netw.ErrCallDeclined):
+		fmt.Printf("%s declined\n", recipient)
+	case errors.Is(err, netw.ErrRecipientBusy):
+		fmt.Printf("%s is busy\n", recipient)
+	case errors.Is(err, netw.ErrCallTimeout):
+		fmt.Printf("%s didn't answer\n", recipient)
+	case errors.Is(err, netw.ErrHungUp):
+		fmt.Printf("%s hung up\n", recipient)
+	case errors.Is(err, netw.ErrConnectionLost):
+		fmt.Printf("lost connection to %s\n", recipient)
+	case err != nil:
+		fmt.Println(err)
+	}
+	if debug {
+		printJitterStats(session)
+	}
+}
+
+// startSession starts a call with the audio source and sink named by input and output, which are closed
+// if the session can't start
+func startSession(ctx context.Context, session *netw.Session, input, output string) error {
+	source, sink, err := openAudio(input, output)
+	if err != nil {
+		return err
+	}
+	session.UseAudio(source, sink)
+	if err = session.Start(ctx); err != nil {
+		_ = source.Close()
+		_ = sink.Close()
+		return err
+	}
+	return nil
+}
+
+// openAudio opens the audio source and sink of a call. An empty name is the default microphone or speaker,
+// "null" is silence, and any other name is the path of a WAV file.
+func openAudio(input, output string) (source audio.Source, sink audio.Sink, err error) {
+	switch input {
+	case "":
+		source = audio.NewMicrophone()
+	case "null":
+		source = audio.NewNullSource()
+	default:
+		if source, err = audio.NewWAVSource(input); err != nil {
+			return nil, nil, fmt.Errorf("error opening input: %w", err)
+		}
+	}
+
+	switch output {
+	case "":
+		sink = audio.NewSpeaker()
+	case "null":
+		sink = audio.NewNullSink()
+	default:
+		if sink, err = audio.NewWAVSink(output); err != nil {
+			_ = source.Close()
+			return nil, nil, fmt.Errorf("error opening output: %w", err)
+		}
+	}
+	return source, sink, nil
+}
+
+// printProgress prints the progress of a call with a friend until it ends
+func printProgress(session *netw.Session, friend string, reconnectGrace time.Duration) {
+	reconnecting := false
+	for event := range session.Events() {
+		switch event.State {
+		case netw.SessionRinging:
+			fmt.Printf("%s is ringing\n", friend)
+		case netw.SessionConnected:
+			if reconnecting {
+				fmt.Println("reconnected")
+			} else {
+				fmt.Printf("connected to %s\n", friend)
+			}
+			reconnecting = false
+		case netw.SessionReconnecting:
+			reconnecting = true
+			fmt.Printf("connection lost, reconnecting for up to %s\n", reconnectGrace)
+		}
+	}
+}
+
+// printJitterStats prints how the audio of each track of the other client arrived and played during a call
+func printJitterStats(session *netw.Session) {
+	for _, stats := range session.JitterStats() {
+		fmt.Printf("track %s: %d recieved, %d late, %d duplicate, %d lost (%d recovered), %d dropped, %d underruns\n",
+			stats.Track, stats.Received, stats.Late, stats.Duplicate, stats.Lost, stats.Recovered, stats.Dropped,
+			stats.Underruns)
+		fmt.Printf("track %s: %s jitter, %s delay (%s target)\n",
+			stats.Track, stats.Jitter, stats.Delay, stats.TargetDelay)
+	}
+}
+
+// muteOnEnter toggles mute each time a line is entered, until stdin is closed
+func muteOnEnter(session *netw.Session) {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		toggleMute(session)
+	}
+}
+
+// toggleMute mutes the microphone of a call if it isn't muted, and unmutes it otherwise
+func toggleMute(session *netw.Session) {
+	muted := !session.Muted()
+	session.Mute(muted)
+	if muted {
+		fmt.Println("muted, press enter to unmute")
+	} else {
+		fmt.Println("unmuted")
 	}
 }
@@ -33,20 +33,25 @@ var createChannelCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(createChannelCmd)
+
+	createChannelCmd.Flags().String("mode", "mesh", "how members connect: mesh (peer to peer), sfu (forwarded by the server, for larger channels) or mcu (mixed by the server, for low bandwidth)")
+	createChannelCmd.Flags().Int("capacity", 0, "maximum number of members in the voice room (default is the server's)")
+	_ = viper.BindPFlag("channelMode", createChannelCmd.Flags().Lookup("mode"))
+	_ = viper.BindPFlag("channelCapacity", createChannelCmd.Flags().Lookup("capacity"))
 }
 
 func createChannel(_ *cobra.Command, _ []string) {
-	_, username, password, channelName, vogoServer := viper.GetBool("debug"),
-		viper.GetString("user.name"),
-		viper.GetString("user.password"),
+	_, channelName, mode, capacity, vogoServer := viper.GetBool("debug"),
 		viper.GetString("channelName"),
+		viper.GetString("channelMode"),
+		viper.GetInt("channelCapacity"),
 		viper.GetString("servers.vogo-origin")
 
-	vogoClient := crud.NewClient(vogoServer, username, password)
-	friend, err := crud.CreateChannel(vogoClient, channelName, "", 0)
+	vogoClient := crud.NewClient(vogoServer, sessionToken())
+	channel, err := crud.CreateChannel(vogoClient, channelName, "", mode, capacity)
 	if err != nil {
 		log.Fatal(fmt.Errorf("error creating channel: %w", err).Error())
 	}
 
-	log.Printf("Created channel: %s", friend.Name)
+	log.Printf("Created %s channel: %s (%d)", channel.Mode, channel.Name, channel.Capacity)
 }
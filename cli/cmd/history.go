@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gregriff/vogo/cli/internal/netw/crud"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List your recent calls and channel visits",
+	Args:  cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if viper.GetInt("historyLimit") < 1 || viper.GetInt("historyLimit") > 100 {
+			return fmt.Errorf("limit must be between 1 and 100")
+		}
+		if viper.GetInt("historyPage") < 1 {
+			return fmt.Errorf("page must be at least 1")
+		}
+		return nil
+	},
+	Run: getHistory,
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().Int("limit", 20, "number of calls per page")
+	historyCmd.Flags().Int("page", 1, "page of older calls to show, starting at 1 for the newest")
+	_ = viper.BindPFlag("historyLimit", historyCmd.Flags().Lookup("limit"))
+	_ = viper.BindPFlag("historyPage", historyCmd.Flags().Lookup("page"))
+}
+
+func getHistory(_ *cobra.Command, _ []string) {
+	_, username, limit, page, vogoServer := viper.GetBool("debug"),
+		viper.GetString("user.name"),
+		viper.GetInt("historyLimit"),
+		viper.GetInt("historyPage"),
+		viper.GetString("servers.vogo-origin")
+
+	vogoClient := crud.NewClient(vogoServer, sessionToken())
+	history, err := crud.Calls(vogoClient, limit, (page-1)*limit)
+	if err != nil {
+		log.Fatal(fmt.Errorf("error fetching call history: %w", err).Error())
+	}
+
+	if len(history.Calls) == 0 {
+		fmt.Println("\nNo Calls")
+		return
+	}
+
+	fmt.Println("\nCalls: ")
+	for _, call := range history.Calls {
+		printCall(call, username)
+	}
+	if history.More {
+		fmt.Printf("\nolder calls: vogo history --page %d\n", page+1)
+	}
+}
+
+// printCall prints a call from the point of view of the user
+func printCall(call crud.CallRecord, username string) {
+	var with string
+	switch {
+	case call.Channel != "":
+		with = "in " + call.Channel
+	case strings.EqualFold(call.Caller, username):
+		with = "to " + call.Recipient
+	default:
+		with = "from " + call.Caller
+	}
+
+	started := call.StartedAt.Local().Format("Jan 2 15:04")
+	if call.Duration != nil {
+		duration := time.Duration(*call.Duration) * time.Second
+		fmt.Printf("%s  %s %s (%s)\n", started, call.Outcome, with, duration)
+		return
+	}
+	fmt.Printf("%s  %s %s\n", started, call.Outcome, with)
+}
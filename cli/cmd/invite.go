@@ -43,14 +43,12 @@ func init() {
 }
 
 func inviteFriend(_ *cobra.Command, _ []string) {
-	_, username, password, channelName, friendName, vogoServer := viper.GetBool("debug"),
-		viper.GetString("user.name"),
-		viper.GetString("user.password"),
+	_, channelName, friendName, vogoServer := viper.GetBool("debug"),
 		viper.GetString("channelName"),
 		viper.GetString("friendName"),
 		viper.GetString("servers.vogo-origin")
 
-	vogoClient := crud.NewClient(vogoServer, username, password)
+	vogoClient := crud.NewClient(vogoServer, sessionToken())
 	friend, err := crud.InviteFriend(vogoClient, channelName, friendName)
 	if err != nil {
 		log.Fatal(fmt.Errorf("error inviting friend: %w", err).Error())
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gregriff/vogo/cli/internal/netw"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var joinCmd = &cobra.Command{
+	Use:   "join [channel]",
+	Short: "Join the voice room of a channel you are a member of",
+	Long: `Arguments:
+      channel    The name of the channel (required)
+	`,
+	Args: cobra.ExactArgs(1),
+	PreRunE: func(_ *cobra.Command, args []string) error {
+		if err := checkSession(); err != nil {
+			return err
+		}
+
+		channelName := args[0]
+		if len(channelName) > 20 {
+			return fmt.Errorf("channel name too long")
+		}
+		if channelName == "" {
+			return fmt.Errorf("must specify a channel name")
+		}
+		viper.Set("channelName", channelName)
+		return nil
+	},
+	Run: joinChannel,
+}
+
+func init() {
+	rootCmd.AddCommand(joinCmd)
+}
+
+func joinChannel(_ *cobra.Command, _ []string) {
+	_, username, vogoServer, stunServer, channelName, fec := viper.GetBool("debug"),
+		viper.GetString("user.name"),
+		viper.GetString("servers.vogo-origin"),
+		viper.GetString("servers.stun-origin"),
+		viper.GetString("channelName"),
+		viper.GetBool("calls.fec")
+
+	ctx, stop := signal.NotifyContext(context.Background(),
+		os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cert, peers := peerIdentity()
+	credentials := netw.NewCredentials(stunServer, vogoServer, username, sessionToken, cert, peers)
+	err := netw.JoinChannel(ctx, credentials, channelName, fec)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gregriff/vogo/cli/internal/netw"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var listenCmd = &cobra.Command{
+	Use:   "listen",
+	Short: "Wait for calls from friends, ringing when one calls",
+	Long: `Stays connected to the vogo server and rings when a friend calls.
+Enter y to answer the call or n to decline it. During a call, enter mutes or
+unmutes your microphone, and ctrl-C hangs up and returns to listening.
+Otherwise, ctrl-C exits.
+	`,
+	Args: cobra.NoArgs,
+	PreRunE: func(_ *cobra.Command, _ []string) error {
+		if err := checkSession(); err != nil {
+			return err
+		}
+		return nil
+	},
+	Run: listen,
+}
+
+func init() {
+	rootCmd.AddCommand(listenCmd)
+}
+
+const (
+	// how often the terminal bell rings while a call is waiting to be answered
+	ringInterval = 3 * time.Second
+
+	declineTimeout = 5 * time.Second
+)
+
+func listen(_ *cobra.Command, _ []string) {
+	_, username, vogoServer, stunServer, reconnectGrace, fec := viper.GetBool("debug"),
+		viper.GetString("user.name"),
+		viper.GetString("servers.vogo-origin"),
+		viper.GetString("servers.stun-origin"),
+		viper.GetDuration("calls.reconnect-grace"),
+		viper.GetBool("calls.fec")
+
+	// ctrl-C either hangs up or exits, so signals are handled here instead of by a context
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cert, peers := peerIdentity()
+	credentials := netw.NewCredentials(stunServer, vogoServer, username, sessionToken, cert, peers)
+	events := make(chan netw.Event, 10)
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- netw.ListenEvents(ctx, credentials, events)
+	}()
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- strings.ToLower(strings.TrimSpace(scanner.Text()))
+		}
+	}()
+
+	ring := time.NewTicker(ringInterval)
+	defer ring.Stop()
+
+	var (
+		// callers waiting to be answered, oldest first
+		ringing []string
+
+		// set while a call is in progress
+		call      *netw.Session
+		callEnded = make(chan error, 1)
+	)
+	defer func() {
+		if call != nil {
+			call.Hangup()
+			<-callEnded
+		}
+	}()
+
+	prompt := func() {
+		if call == nil && len(ringing) > 0 {
+			fmt.Printf("\a%s is calling. answer? [y/n] ", ringing[0])
+		}
+	}
+
+	fmt.Println("listening for calls")
+	for {
+		select {
+		case sig := <-signals:
+			if call == nil {
+				log.Printf("recieved %s, exiting", sig)
+				return
+			}
+			call.Hangup()
+		case err := <-listenErr:
+			if err != nil {
+				fmt.Println(err)
+			}
+			return
+		case err := <-callEnded:
+			call = nil
+			switch {
+			case errors.Is(err, netw.ErrHungUp):
+				fmt.Println("the caller hung up")
+			case err != nil:
+				fmt.Println(err)
+			}
+			fmt.Println("call ended, listening for calls")
+			prompt()
+		case <-ring.C:
+			if call == nil && len(ringing) > 0 {
+				fmt.Print("\a")
+			}
+		case event := <-events:
+			switch event.Type {
+			case netw.EventIncomingCall:
+				if slices.Contains(ringing, event.From) {
+					continue
+				}
+				ringing = append(ringing, event.From)
+				if call != nil {
+					fmt.Printf("%s is calling, hang up to answer\n", event.From)
+				} else if len(ringing) == 1 {
+					prompt()
+				}
+			case netw.EventCallCancelled:
+				if i := slices.Index(ringing, event.From); i != -1 {
+					ringing = slices.Delete(ringing, i, i+1)
+					fmt.Printf("\n%s hung up\n", event.From)
+					prompt()
+				}
+			case netw.EventFriendRequest:
+				fmt.Printf("%s sent you a friend request. accept with: vogo add %s\n", event.From, event.From)
+			case netw.EventFriendAccepted:
+				fmt.Printf("%s accepted your friend request\n", event.From)
+			case netw.EventFriendOnline:
+				fmt.Printf("%s is online\n", event.From)
+			case netw.EventChannelInvite:
+				fmt.Printf("%s added you to %s. join with: vogo join %s\n", event.From, event.Channel, event.Channel)
+			}
+		case line := <-lines:
+			if call != nil {
+				toggleMute(call)
+				continue
+			}
+			if len(ringing) == 0 {
+				continue
+			}
+			caller := ringing[0]
+			switch line {
+			case "y", "yes":
+				ringing = ringing[1:]
+				session := netw.NewAnswer(credentials, caller, reconnectGrace)
+				session.UseFEC(fec)
+				if err := session.Start(ctx); err != nil {
+					fmt.Println(err)
+					prompt()
+					continue
+				}
+				call = session
+				go func() {
+					printProgress(session, caller, reconnectGrace)
+					callEnded <- session.Wait()
+				}()
+				fmt.Printf("answering %s, ctrl-C to hang up\n", caller)
+			case "n", "no":
+				ringing = ringing[1:]
+				declineCtx, cancelDecline := context.WithTimeout(ctx, declineTimeout)
+				if err := netw.DeclineCall(declineCtx, credentials, caller); err != nil {
+					fmt.Println(err)
+				} else {
+					fmt.Printf("declined %s\n", caller)
+				}
+				cancelDecline()
+				prompt()
+			default:
+				prompt()
+			}
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gregriff/vogo/cli/configs"
+	"github.com/gregriff/vogo/cli/internal/identity"
+	"github.com/gregriff/vogo/cli/internal/netw/crud"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log in to the vogo server with a password or key pair, replacing the password in the config file with a session token",
+	Args:  cobra.NoArgs,
+	PreRunE: func(_ *cobra.Command, _ []string) error {
+		username, password := viper.GetString("user.name"), viper.GetString("user.password")
+		if len(username) == 0 {
+			return fmt.Errorf("username not found. ensure it is present in %s", ConfigFile)
+		}
+		if len(password) == 0 && !hasKey() {
+			return fmt.Errorf("password not found. pass --password or add it to %s", ConfigFile)
+		}
+		return nil
+	},
+	Run: login,
+}
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Revoke this client's session and remove it from the config file",
+	Args:  cobra.NoArgs,
+	Run:   logout,
+}
+
+func init() {
+	rootCmd.AddCommand(loginCmd)
+	rootCmd.AddCommand(logoutCmd)
+
+	loginCmd.Flags().String("password", "", "password of the user (default is the password in the config file)")
+	_ = viper.BindPFlag("user.password", loginCmd.Flags().Lookup("password"))
+}
+
+func login(_ *cobra.Command, _ []string) {
+	_, username, password, vogoServer := viper.GetBool("debug"),
+		viper.GetString("user.name"),
+		viper.GetString("user.password"),
+		viper.GetString("servers.vogo-origin")
+
+	if err := createSession(vogoServer, username, password); err != nil {
+		log.Fatal(fmt.Errorf("error logging in: %w", err).Error())
+	}
+	log.Printf("Logged in as %s", username)
+}
+
+func logout(_ *cobra.Command, _ []string) {
+	_, vogoServer := viper.GetBool("debug"),
+		viper.GetString("servers.vogo-origin")
+
+	if err := checkSession(); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	vogoClient := crud.NewClient(vogoServer, sessionToken())
+	if err := crud.Logout(vogoClient); err != nil {
+		log.Fatal(fmt.Errorf("error logging out: %w", err).Error())
+	}
+	if err := configs.ClearSession(ConfigFile); err != nil {
+		log.Fatal(err.Error())
+	}
+	log.Println("Logged out")
+}
+
+// sessions are refreshed when they expire within this long, so that they don't expire mid-request
+const tokenExpiryMargin = time.Minute
+
+// guards refreshing the session, which is done at most once for concurrent callers of sessionToken
+var sessionMu sync.Mutex
+
+// checkSession returns an error if the config doesn't have a username and a session or password to create one
+func checkSession() error {
+	if len(viper.GetString("user.name")) == 0 {
+		return fmt.Errorf("username not found. ensure it is present in %s", ConfigFile)
+	}
+	if viper.GetString("user.refresh-token") == "" && viper.GetString("user.password") == "" && !hasKey() {
+		return errors.New("not logged in. run `vogo login`")
+	}
+	return nil
+}
+
+// sessionToken returns a session token of the configured user that hasn't expired. If the token expires soon it is
+// refreshed, and if there is no session one is created with the password in the config file. Either way, the new
+// session is written to the config file. It exits if a token can't be obtained.
+func sessionToken() string {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+
+	token, refreshToken, vogoServer := viper.GetString("user.token"),
+		viper.GetString("user.refresh-token"),
+		viper.GetString("servers.vogo-origin")
+
+	if token != "" && time.Until(viper.GetTime("user.token-expires")) > tokenExpiryMargin {
+		return token
+	}
+
+	if refreshToken != "" && time.Until(viper.GetTime("user.refresh-token-expires")) > 0 {
+		session, err := crud.Refresh(crud.NewClient(vogoServer, ""), refreshToken)
+		if err == nil {
+			err = persistSession(session)
+		}
+		if err == nil {
+			return session.Token
+		}
+		log.Printf("error refreshing session: %v", err)
+	}
+
+	username, password := viper.GetString("user.name"), viper.GetString("user.password")
+	if password == "" && !hasKey() {
+		log.Fatal("session expired. run `vogo login`")
+	}
+	if err := createSession(vogoServer, username, password); err != nil {
+		log.Fatal(fmt.Errorf("error logging in: %w", err).Error())
+	}
+	return viper.GetString("user.token")
+}
+
+// createSession logs in and writes the new session to the config file. If password is empty,
+// the user's key pair is used instead.
+func createSession(vogoServer, username, password string) error {
+	client := crud.NewClient(vogoServer, "")
+
+	var (
+		session *crud.Session
+		err     error
+	)
+	if password != "" {
+		session, err = crud.Login(client, username, password, deviceName())
+	} else {
+		session, err = loginWithKey(client, username)
+	}
+	if err != nil {
+		return err
+	}
+	return persistSession(session)
+}
+
+// loginWithKey logs in by signing a challenge from the vogo server with the user's private key
+func loginWithKey(client *http.Client, username string) (*crud.Session, error) {
+	key, err := identity.Load(keyFile())
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := crud.Challenge(client, username)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting challenge: %w", err)
+	}
+	signature := identity.SignChallenge(key, username, challenge)
+	return crud.LoginWithKey(client, username, challenge, signature, deviceName())
+}
+
+// keyFile returns the path of the user's private key
+func keyFile() string {
+	if file := viper.GetString("user.key-file"); file != "" {
+		return file
+	}
+	return filepath.Join(configs.GetConfigDir(), "id_ed25519")
+}
+
+// hasKey returns true if the user's private key exists
+func hasKey() bool {
+	_, err := os.Stat(keyFile())
+	return err == nil
+}
+
+// deviceName returns the name this client's sessions are listed with: the configured device name, or the hostname
+func deviceName() string {
+	if device := viper.GetString("user.device"); device != "" {
+		return device
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return hostname
+}
+
+// persistSession writes a session to the config file
+func persistSession(session *crud.Session) error {
+	err := configs.PersistSession(
+		ConfigFile,
+		session.Token,
+		session.RefreshToken,
+		session.ExpiresAt,
+		session.RefreshExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving session: %w", err)
+	}
+	return nil
+}
@@ -1,11 +1,14 @@
 package cmd
 
 import (
+	"crypto/ed25519"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"regexp"
 
+	"github.com/gregriff/vogo/cli/internal/identity"
 	"github.com/gregriff/vogo/cli/internal/netw/crud"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -34,38 +37,61 @@ func init() {
 	registerCmd.PersistentFlags().String(flagName, "", "invite code for a vogo server")
 	_ = viper.BindPFlag(flagName, registerCmd.PersistentFlags().Lookup(flagName))
 
+	registerCmd.Flags().Bool("key", false, "authenticate with an ed25519 key pair instead of a password. the key is created if it doesn't exist")
+	_ = viper.BindPFlag("registerKey", registerCmd.Flags().Lookup("key"))
+
 }
 
 func registerUser(_ *cobra.Command, _ []string) {
-	_, username, password, inviteCode, vogoServer := viper.GetBool("debug"),
+	_, username, password, inviteCode, useKey, vogoServer := viper.GetBool("debug"),
 		viper.GetString("user.name"),
 		viper.GetString("user.password"),
 		viper.GetString("code"),
+		viper.GetBool("registerKey"),
 		viper.GetString("servers.vogo-origin")
 
 	if vErr := validateUsername(username); vErr != nil {
 		msg := fmt.Errorf("invalid username %s (%w)", username, vErr)
 		log.Fatal(msg.Error())
 	}
-	if vErr := validatePassword(password); vErr != nil {
-		msg := fmt.Errorf("invalid password %s (%w)", password, vErr)
-		log.Fatal(msg.Error())
+	if !useKey || password != "" {
+		if vErr := validatePassword(password); vErr != nil {
+			msg := fmt.Errorf("invalid password %s (%w)", password, vErr)
+			log.Fatal(msg.Error())
+		}
+	}
+
+	var publicKey string
+	if useKey {
+		key, err := loadOrGenerateKey(keyFile())
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		publicKey = identity.PublicKey(key)
 	}
 
-	vogoClient := crud.NewClient(vogoServer, "", "")
-	username, err := crud.Register(vogoClient, username, password, inviteCode)
+	vogoClient := crud.NewClient(vogoServer, "")
+	username, err := crud.Register(vogoClient, username, password, publicKey, inviteCode)
 	if err != nil {
 		log.Fatal(fmt.Errorf("error during registration: %w", err).Error())
 	}
 
-	// writeErr := configs.PersistCredentialsToConfig(ConfigFile, username, friendCode)
-	// if writeErr != nil {
-	// 	log.Fatalf(
-	// 		`error writing username to config file. please write username=%s to %s`,
-	// 		username, ConfigFile,
-	// 	)
-	// }
 	log.Printf("Now registered with username: %s", username)
+
+	if err = createSession(vogoServer, username, password); err != nil {
+		log.Fatal(fmt.Errorf("error logging in, run `vogo login` to retry: %w", err).Error())
+	}
+	log.Printf("Logged in as %s", username)
+}
+
+// loadOrGenerateKey loads the user's private key, creating it if it doesn't exist
+func loadOrGenerateKey(file string) (ed25519.PrivateKey, error) {
+	key, err := identity.Load(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Printf("creating key pair (%s)", file)
+		return identity.Generate(file)
+	}
+	return key, err
 }
 
 var validCharsUsername = regexp.MustCompile(`^[A-Za-z\d@$!%*?&]+$`)
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/gregriff/vogo/cli/configs"
 	"github.com/spf13/cobra"
@@ -48,11 +49,15 @@ func init() {
 	defaultConfigFilePath := fmt.Sprintf("%s/vogo.toml", configDir)
 	rootCmd.PersistentFlags().StringVar(&ConfigFile, "config", defaultConfigFilePath, "config file")
 
-	rootCmd.PersistentFlags().String("stun-server", "stun:stun.l.google.com:19302", "STUN server origin")
+	rootCmd.PersistentFlags().String("stun-server", "", "STUN server origin, used in addition to the ICE servers of the vogo server")
 	rootCmd.PersistentFlags().String("vogo-server", "", "vogo Server Address")
 	rootCmd.PersistentFlags().Bool("debug", false, "print debugging information")
+	rootCmd.PersistentFlags().Duration("reconnect-grace", 30*time.Second, "how long a call may stay disconnected before giving up on it")
+	rootCmd.PersistentFlags().Bool("fec", false, "send audio with in-band FEC, so that lost packets can be recovered, at the cost of bitrate")
 
 	// expose to application via viper
 	_ = viper.BindPFlag("debug", rootCmd.PersistentFlags().Lookup("debug"))
 	_ = viper.BindPFlag("servers.stun-origin", rootCmd.PersistentFlags().Lookup("stun-server"))
+	_ = viper.BindPFlag("calls.reconnect-grace", rootCmd.PersistentFlags().Lookup("reconnect-grace"))
+	_ = viper.BindPFlag("calls.fec", rootCmd.PersistentFlags().Lookup("fec"))
 }
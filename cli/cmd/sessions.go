@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gregriff/vogo/cli/configs"
+	"github.com/gregriff/vogo/cli/internal/netw/crud"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "Manage the devices logged in as your user",
+}
+
+var listSessionsCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the devices logged in as your user",
+	Args:  cobra.NoArgs,
+	Run:   listSessions,
+}
+
+var revokeSessionCmd = &cobra.Command{
+	Use:   "revoke [id]",
+	Short: "Log a device out, given the id of its session",
+	Long: `Arguments:
+      id    The id of the session from 'vogo sessions list', or the start of it (required)
+	`,
+	Args: cobra.ExactArgs(1),
+	PreRunE: func(_ *cobra.Command, args []string) error {
+		sessionId := strings.TrimSpace(args[0])
+		if sessionId == "" {
+			return fmt.Errorf("must specify a session id")
+		}
+		viper.Set("sessionId", sessionId)
+		return nil
+	},
+	Run: revokeSession,
+}
+
+func init() {
+	rootCmd.AddCommand(sessionsCmd)
+	sessionsCmd.AddCommand(listSessionsCmd)
+	sessionsCmd.AddCommand(revokeSessionCmd)
+}
+
+func listSessions(_ *cobra.Command, _ []string) {
+	_, vogoServer := viper.GetBool("debug"),
+		viper.GetString("servers.vogo-origin")
+
+	vogoClient := crud.NewClient(vogoServer, sessionToken())
+	sessions, err := crud.Sessions(vogoClient)
+	if err != nil {
+		log.Fatal(fmt.Errorf("error fetching sessions: %w", err).Error())
+	}
+
+	fmt.Println("\nSessions: ")
+	for _, session := range sessions {
+		device := session.Device
+		if device == "" {
+			device = "unknown device"
+		}
+		if session.Current {
+			device += " (this device)"
+		}
+
+		created, lastUsed := session.CreatedAt.Local().Format("Jan 2 15:04"),
+			session.LastUsedAt.Local().Format("Jan 2 15:04")
+		fmt.Printf("%s  %s\n", session.Id, device)
+		fmt.Printf("    from %s, last used %s, logged in %s\n", session.IP, lastUsed, created)
+	}
+}
+
+func revokeSession(_ *cobra.Command, _ []string) {
+	_, sessionId, vogoServer := viper.GetBool("debug"),
+		viper.GetString("sessionId"),
+		viper.GetString("servers.vogo-origin")
+
+	vogoClient := crud.NewClient(vogoServer, sessionToken())
+	sessions, err := crud.Sessions(vogoClient)
+	if err != nil {
+		log.Fatal(fmt.Errorf("error fetching sessions: %w", err).Error())
+	}
+
+	// allow the id to be abbreviated, as long as it matches one session
+	var matches []crud.ActiveSession
+	for _, session := range sessions {
+		if strings.HasPrefix(session.Id, strings.ToLower(sessionId)) {
+			matches = append(matches, session)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		log.Fatalf("no session found with id %s", sessionId)
+	case 1:
+	default:
+		log.Fatalf("more than one session has an id starting with %s", sessionId)
+	}
+
+	session := matches[0]
+	if err = crud.RevokeSession(vogoClient, session.Id); err != nil {
+		log.Fatal(fmt.Errorf("error revoking session: %w", err).Error())
+	}
+
+	// this client can't use its session anymore
+	if session.Current {
+		if err = configs.ClearSession(ConfigFile); err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+	log.Printf("Revoked session of %s", session.Device)
+}
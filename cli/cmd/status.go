@@ -1,7 +1,5 @@
 package cmd
 
-// TODO: status should authenticate and issue a JWT
-
 import (
 	"fmt"
 	"log"
@@ -25,20 +23,35 @@ func init() {
 }
 
 func getStatus(_ *cobra.Command, _ []string) {
-	_, username, password, vogoServer := viper.GetBool("debug"),
+	_, username, vogoServer := viper.GetBool("debug"),
 		viper.GetString("user.name"),
-		viper.GetString("user.password"),
 		viper.GetString("servers.vogo-origin")
 
-	vogoClient := crud.NewClient(vogoServer, username, password)
+	vogoClient := crud.NewClient(vogoServer, sessionToken())
 	status, err := crud.Status(vogoClient)
 	if err != nil {
 		log.Printf("error fetching status: %v", err)
 		return
 	}
 
+	printMissedCalls(status.MissedCalls, username)
 	printFriends(status.Friends)
 	printChannels(status.Channels)
+
+	if status.STUNServer != "" {
+		fmt.Printf("\nSTUN server: %s\n", status.STUNServer)
+	}
+}
+
+func printMissedCalls(calls []crud.CallRecord, username string) {
+	if len(calls) == 0 {
+		return
+	}
+
+	fmt.Println("\nMissed Calls: ")
+	for _, call := range calls {
+		printCall(call, username)
+	}
 }
 
 func printFriends(friends []crud.Friend) {
@@ -79,6 +92,6 @@ func printChannels(channels []crud.Channel) {
 	fmt.Println("\nChannels: ")
 	for _, channel := range channels {
 		memberNames := strings.Trim(channel.MemberNames, "{}")
-		fmt.Printf("%s (%d) - members: %s\n", channel.Name, channel.Capacity, memberNames)
+		fmt.Printf("%s (%d, %s) - members: %s\n", channel.Name, channel.Capacity, channel.Mode, memberNames)
 	}
 }
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/gregriff/vogo/cli/configs"
+	"github.com/gregriff/vogo/cli/internal/identity"
+	"github.com/pion/webrtc/v4"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify [username]",
+	Short: "Show a code to compare with a friend, verifying that your calls aren't intercepted",
+	Long: `The fingerprint of a friend's certificate is pinned the first time you call them.
+Both of you should see the same code. Read it to each other during a call.
+
+Arguments:
+      name    The username of the friend to verify (required)
+	`,
+	Args: cobra.ExactArgs(1),
+	PreRunE: func(_ *cobra.Command, args []string) error {
+		friendName := args[0]
+		if len(friendName) > 16 {
+			return fmt.Errorf("friend's name too long")
+		}
+		if friendName == "" {
+			return fmt.Errorf("must specify a friend's username")
+		}
+		viper.Set("friendName", friendName)
+		return nil
+	},
+	Run: verifyFriend,
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().Bool("forget", false, "remove the friend's pinned fingerprint, pinning the next one seen")
+	_ = viper.BindPFlag("verifyForget", verifyCmd.Flags().Lookup("forget"))
+}
+
+func verifyFriend(_ *cobra.Command, _ []string) {
+	_, friendName, forget := viper.GetBool("debug"),
+		viper.GetString("friendName"),
+		viper.GetBool("verifyForget")
+
+	peers, err := identity.LoadPeers(knownPeersFile())
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	if forget {
+		if err = peers.Forget(friendName); err != nil {
+			log.Fatal(err.Error())
+		}
+		log.Printf("Forgot the fingerprint of %s", friendName)
+		return
+	}
+
+	cert, err := identity.LoadOrCreateCertificate(certificateFile())
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	fingerprint, err := identity.Fingerprint(cert)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	pin, exists := peers.Get(friendName)
+	if !exists {
+		log.Fatalf("no fingerprint pinned for %s. call them first", friendName)
+	}
+
+	fmt.Printf("\nyour fingerprint:        %s\n", fingerprint)
+	fmt.Printf("%s's fingerprint: %s (pinned %s)\n", friendName, pin.Fingerprint, pin.PinnedAt.Local().Format("Jan 2 2006"))
+	fmt.Printf("\ncode: %s\n", identity.ShortAuthString(fingerprint, pin.Fingerprint))
+	fmt.Printf("\nIf %s sees a different code, one of your calls was intercepted.\n", friendName)
+}
+
+// peerIdentity loads the client's DTLS certificate and the pinned fingerprints of friends. If either can't be
+// loaded, calls still work, but without a stable fingerprint or pinning.
+func peerIdentity() (*webrtc.Certificate, *identity.Peers) {
+	cert, err := identity.LoadOrCreateCertificate(certificateFile())
+	if err != nil {
+		log.Printf("error loading certificate, friends can't verify this client: %v", err)
+		return nil, nil
+	}
+	peers, err := identity.LoadPeers(knownPeersFile())
+	if err != nil {
+		log.Printf("error loading known peers, fingerprints won't be verified: %v", err)
+		return cert, nil
+	}
+	return cert, peers
+}
+
+// certificateFile returns the path of the client's DTLS certificate
+func certificateFile() string {
+	return filepath.Join(configs.GetConfigDir(), "dtls.pem")
+}
+
+// knownPeersFile returns the path of the pinned fingerprints of friends
+func knownPeersFile() string {
+	return filepath.Join(configs.GetConfigDir(), "known_peers.json")
+}
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	_ "embed" // used to embed the default application config file.
 
@@ -72,26 +73,46 @@ func GetConfigDir() string {
 	return appConfigDir
 }
 
-// PersistCredentialsToConfig updates the vogo config file with the username
-// given by the server and the entered password (plaintext)
-// TODO: this may be used in the future to update the config file
-// func PersistCredentialsToConfig(filename, username, friendCode string) error {
-// 	var config map[string]any
+// PersistSession writes the tokens of a session to the config file, removing the plaintext password
+// since it is no longer needed. The loaded config is updated as well. Comments in the file are not preserved.
+func PersistSession(file, token, refreshToken string, expiresAt, refreshExpiresAt time.Time) error {
+	session := map[string]any{
+		"user.password":              "",
+		"user.token":                 token,
+		"user.refresh-token":         refreshToken,
+		"user.token-expires":         expiresAt.Format(time.RFC3339),
+		"user.refresh-token-expires": refreshExpiresAt.Format(time.RFC3339),
+	}
+	return updateConfigFile(file, session)
+}
 
-// 	data, err := os.ReadFile(filename)
-// 	if err != nil {
-// 		return errors.New("config file not found! developer error")
-// 	}
+// ClearSession removes the tokens of a session from the config file and the loaded config
+func ClearSession(file string) error {
+	session := map[string]any{
+		"user.token":                 "",
+		"user.refresh-token":         "",
+		"user.token-expires":         "",
+		"user.refresh-token-expires": "",
+	}
+	return updateConfigFile(file, session)
+}
 
-// 	// loads entire config
-// 	toml.Unmarshal(data, &config)
-// 	config["username"] = username
-// 	config["friend-code"] = friendCode
+// updateConfigFile sets keys in the config file without writing values from flags or the environment to it
+func updateConfigFile(file string, values map[string]any) error {
+	config := viper.New()
+	config.SetConfigFile(file)
+	config.SetConfigType("toml")
+	if err := config.ReadInConfig(); err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
 
-// 	data, err = toml.Marshal(config)
-// 	if err != nil {
-// 		return fmt.Errorf("marshaling error: %w", err)
-// 	}
+	for key, value := range values {
+		config.Set(key, value)
+		viper.Set(key, value)
+	}
 
-// 	return os.WriteFile(filename, data, 0644)
-// }
+	if err := config.WriteConfig(); err != nil {
+		return fmt.Errorf("error writing config file: %w", err)
+	}
+	return nil
+}
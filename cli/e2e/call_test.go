@@ -0,0 +1,331 @@
+package e2e
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gregriff/vogo/cli/internal/audio"
+	"github.com/gregriff/vogo/cli/internal/netw"
+	"github.com/gregriff/vogo/cli/internal/netw/crud"
+	"github.com/gregriff/vogo/server/testserver"
+)
+
+const (
+	// length of the audio each client sends
+	signalDuration = 3 * time.Second
+
+	// audio is compared by its loudness over windows of this many samples per channel (10ms)
+	envelopeWindow = audio.SampleRate / 100
+
+	// the longest delay searched for between sent and recieved audio
+	maxDelay = 5 * time.Second
+
+	// how closely the recieved audio must follow the sent audio, from 0 to 1
+	minCorrelation = 0.8
+
+	// size of the header of the WAV files written by audio.NewWAVSink
+	wavHeaderSize = 44
+)
+
+// TestCall registers two friends with an in-process vogo server and calls one from the other over loopback,
+// with each client sending a different WAV file, and checks that each client recorded the other's audio.
+// It needs a postgres server set by the PG environment variables that allows creating databases, and is skipped
+// without one. Run it with make test-e2e.
+func TestCall(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping end-to-end call in short mode")
+	}
+	server := testserver.New(t)
+	caller, recipient := register(t, server), register(t, server)
+	befriend(t, server, caller, recipient)
+
+	dir := t.TempDir()
+	callerSent := writeSignal(t, filepath.Join(dir, "caller.wav"), 1)
+	recipientSent := writeSignal(t, filepath.Join(dir, "recipient.wav"), 2)
+	callerRecording := filepath.Join(dir, "caller-recording.wav")
+	recipientRecording := filepath.Join(dir, "recipient-recording.wav")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// the recipient answers once the server tells them that they are being called, like vogo listen
+	events := make(chan netw.Event)
+	listenCtx, stopListening := context.WithCancel(ctx)
+	defer stopListening()
+	go func() {
+		_ = netw.ListenEvents(listenCtx, recipient.credentials(server), events)
+	}()
+
+	// only the caller sends FEC, so that audio with and without it is checked
+	call := netw.NewCall(caller.credentials(server), recipient.name, 10*time.Second)
+	call.UseFEC(true)
+	useAudio(t, call, callerSent, callerRecording)
+	if err := call.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer call.Hangup()
+
+	waitForCall(ctx, t, events, caller.name)
+	stopListening()
+
+	answer := netw.NewAnswer(recipient.credentials(server), caller.name, 10*time.Second)
+	useAudio(t, answer, recipientSent, recipientRecording)
+	if err := answer.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer answer.Hangup()
+
+	waitForState(ctx, t, "caller", call, netw.SessionConnected)
+	waitForState(ctx, t, "recipient", answer, netw.SessionConnected)
+
+	// let each client send all of its audio, with time for it to arrive
+	select {
+	case <-ctx.Done():
+		t.Fatal("timed out during call")
+	case <-time.After(signalDuration + 2*time.Second):
+	}
+
+	call.Hangup()
+	if err := call.Wait(); err != nil {
+		t.Errorf("caller ended with %v", err)
+	}
+	if err := answer.Wait(); !errors.Is(err, netw.ErrHungUp) {
+		t.Errorf("recipient ended with %v, want %v", err, netw.ErrHungUp)
+	}
+
+	checkRecording(t, "caller", recipientSent, callerRecording)
+	checkRecording(t, "recipient", callerSent, recipientRecording)
+}
+
+// testUser is a user registered with the test server
+type testUser struct {
+	name, token string
+}
+
+// register registers and logs in a new user with a random name
+func register(t *testing.T, server *testserver.Server) testUser {
+	t.Helper()
+	const password = "password"
+	name := fmt.Sprintf("test%d", rand.Uint32())
+
+	client := crud.NewClient(server.URL, "")
+	if _, err := crud.Register(client, name, password, "", server.InviteCode(t)); err != nil {
+		t.Fatalf("error registering %s: %v", name, err)
+	}
+	session, err := crud.Login(client, name, password, "test")
+	if err != nil {
+		t.Fatalf("error logging in %s: %v", name, err)
+	}
+	return testUser{name: name, token: session.Token}
+}
+
+// befriend makes two users friends, so that they can call each other
+func befriend(t *testing.T, server *testserver.Server, a, b testUser) {
+	t.Helper()
+	if _, err := crud.AddFriend(crud.NewClient(server.URL, a.token), b.name); err != nil {
+		t.Fatalf("error adding friend: %v", err)
+	}
+	if _, err := crud.AddFriend(crud.NewClient(server.URL, b.token), a.name); err != nil {
+		t.Fatalf("error accepting friend: %v", err)
+	}
+}
+
+// credentials returns the credentials of the user, without a DTLS certificate or pinned fingerprints
+func (u testUser) credentials(server *testserver.Server) *netw.Credentials {
+	return netw.NewCredentials("", server.URL, u.name, func() string { return u.token }, nil, nil)
+}
+
+// useAudio sends the WAV file at input during a session, and records the call to the WAV file at output
+func useAudio(t *testing.T, session *netw.Session, input, output string) {
+	t.Helper()
+	source, err := audio.NewWAVSource(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink, err := audio.NewWAVSink(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.UseAudio(source, sink)
+}
+
+// waitForCall waits for the server to tell a listening client that caller is calling them
+func waitForCall(ctx context.Context, t *testing.T, events <-chan netw.Event, caller string) {
+	t.Helper()
+	for {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("%s never called", caller)
+		case event := <-events:
+			if event.Type == netw.EventIncomingCall && event.From == caller {
+				return
+			}
+		}
+	}
+}
+
+// waitForState waits for a session to move to state, failing the test if it ends first
+func waitForState(ctx context.Context, t *testing.T, name string, session *netw.Session, state netw.SessionState) {
+	t.Helper()
+	for session.State() != state {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("%s never became %s", name, state)
+		case event, ok := <-session.Events():
+			if !ok || event.State == netw.SessionEnded {
+				t.Fatalf("%s ended before becoming %s: %v", name, state, session.Wait())
+			}
+		}
+	}
+}
+
+// writeSignal writes a WAV file of signalDuration that bursts a tone on and off at random, so that it can be
+// found in a recording by its loudness. Each seed writes different audio. path is returned.
+func writeSignal(t *testing.T, path string, seed uint64) string {
+	t.Helper()
+	const (
+		burst     = audio.SampleRate / 10 // samples per channel in each burst or gap
+		frequency = 440.0
+		amplitude = 8_000
+	)
+	random := rand.New(rand.NewPCG(seed, seed))
+	n := int(signalDuration.Seconds() * audio.SampleRate)
+	samples := make([]int16, 0, n*audio.NumChannels)
+
+	var on bool
+	for i := range n {
+		if i%burst == 0 {
+			on = random.IntN(2) == 1
+		}
+		var v int16
+		if on {
+			v = int16(amplitude * math.Sin(2*math.Pi*frequency*float64(i)/audio.SampleRate))
+		}
+		for range audio.NumChannels {
+			samples = append(samples, v)
+		}
+	}
+
+	header := struct {
+		RIFF          [4]byte
+		RIFFSize      uint32
+		WAVE          [4]byte
+		Fmt           [4]byte
+		FmtSize       uint32
+		AudioFormat   uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		Data          [4]byte
+		DataSize      uint32
+	}{
+		RIFF:          [4]byte{'R', 'I', 'F', 'F'},
+		RIFFSize:      uint32(wavHeaderSize - 8 + len(samples)*2),
+		WAVE:          [4]byte{'W', 'A', 'V', 'E'},
+		Fmt:           [4]byte{'f', 'm', 't', ' '},
+		FmtSize:       16,
+		AudioFormat:   1,
+		Channels:      audio.NumChannels,
+		SampleRate:    audio.SampleRate,
+		ByteRate:      audio.SampleRate * audio.NumChannels * 2,
+		BlockAlign:    audio.NumChannels * 2,
+		BitsPerSample: 16,
+		Data:          [4]byte{'d', 'a', 't', 'a'},
+		DataSize:      uint32(len(samples) * 2),
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err = binary.Write(file, binary.LittleEndian, header); err != nil {
+		t.Fatal(err)
+	}
+	if err = binary.Write(file, binary.LittleEndian, samples); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// checkRecording checks that the audio recorded by a client follows the audio the other client sent
+func checkRecording(t *testing.T, name, sent, recording string) {
+	t.Helper()
+	want, got := envelope(readWAV(t, sent)), envelope(readWAV(t, recording))
+
+	best, delay := -1.0, 0
+	for d := 0; d <= int(maxDelay/(10*time.Millisecond)) && d+len(want) <= len(got); d++ {
+		if c := correlation(want, got[d:d+len(want)]); c > best {
+			best, delay = c, d
+		}
+	}
+	t.Logf("%s recorded audio with correlation %.2f, %dms late", name, best, delay*10)
+	if best < minCorrelation {
+		t.Errorf("%s recorded audio with correlation %.2f, want at least %.2f", name, best, minCorrelation)
+	}
+}
+
+// readWAV reads the samples of a WAV file written by writeSignal or audio.NewWAVSink
+func readWAV(t *testing.T, path string) []int16 {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) < wavHeaderSize {
+		t.Fatalf("%s is too short to be a WAV file", path)
+	}
+	data = data[wavHeaderSize:]
+	samples := make([]int16, len(data)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(data[i*2:]))
+	}
+	return samples
+}
+
+// envelope returns the RMS loudness of each window of envelopeWindow samples per channel
+func envelope(samples []int16) []float64 {
+	const size = envelopeWindow * audio.NumChannels
+	windows := make([]float64, len(samples)/size)
+	for i := range windows {
+		var sum float64
+		for _, s := range samples[i*size : (i+1)*size] {
+			sum += float64(s) * float64(s)
+		}
+		windows[i] = math.Sqrt(sum / size)
+	}
+	return windows
+}
+
+// correlation returns the Pearson correlation of a and b, which have the same length
+func correlation(a, b []float64) float64 {
+	var meanA, meanB float64
+	for i := range a {
+		meanA += a[i]
+		meanB += b[i]
+	}
+	meanA /= float64(len(a))
+	meanB /= float64(len(b))
+
+	var cov, varA, varB float64
+	for i := range a {
+		da, db := a[i]-meanA, b[i]-meanB
+		cov += da * db
+		varA += da * da
+		varB += db * db
+	}
+	if varA == 0 || varB == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(varA*varB)
+}
@@ -0,0 +1,3 @@
+// package e2e tests the client end-to-end against an in-process vogo server. It is its own module, so that the
+// client doesn't depend on the server, and needs a postgres server set by the PG environment variables.
+package e2e
@@ -5,6 +5,7 @@ go 1.25.1
 require (
 	github.com/adrg/xdg v0.5.3
 	github.com/gen2brain/malgo v0.11.24
+	github.com/gregriff/vogo/protocol v0.1.0
 	github.com/pion/webrtc/v4 v4.1.6
 	github.com/spf13/cobra v1.10.1
 	github.com/spf13/viper v1.21.0
@@ -41,7 +42,8 @@ require (
 	github.com/subosito/gotenv v1.6.0 // indirect
 	github.com/wlynxg/anet v0.0.5 // indirect
 	go.yaml.in/yaml/v3 v3.0.4 // indirect
-	golang.org/x/crypto v0.33.0 // indirect
-	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/crypto v0.37.0 // indirect
+	golang.org/x/sys v0.36.0 // indirect
 	golang.org/x/text v0.28.0 // indirect
+	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 )
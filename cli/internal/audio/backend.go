@@ -0,0 +1,62 @@
+package audio
+
+import (
+	"sync"
+	"time"
+)
+
+// Source produces the audio sent during a call, such as the default microphone or a WAV file. Audio is
+// interleaved 16-bit PCM with NumChannels channels at SampleRate.
+type Source interface {
+	// Start starts the source, which then calls write with each chunk of PCM it produces, in real time,
+	// until it is closed. write must not retain pcm. It doesn't block, so it may be called from the realtime
+	// callback of an audio device.
+	Start(write func(pcm []int16)) error
+
+	// Close stops the source and releases its resources. It may be called even if Start failed.
+	Close() error
+}
+
+// Sink consumes the audio recieved during a call, such as the default speaker or a WAV file. Audio is
+// interleaved 16-bit PCM with NumChannels channels at SampleRate.
+type Sink interface {
+	// Start starts the sink, which then calls read to fill each chunk of PCM it consumes, in real time,
+	// until it is closed. read fills pcm with silence if no audio is ready.
+	Start(read func(pcm []int16)) error
+
+	// Close stops the sink and releases its resources. It may be called even if Start failed.
+	Close() error
+}
+
+// pacer runs a function once per frame for sources and sinks that aren't driven by an audio device
+type pacer struct {
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// start runs fn every frameDuration in a new goroutine until close is called
+func (p *pacer) start(fn func()) {
+	p.stop = make(chan struct{})
+	p.wg.Go(func() {
+		ticker := time.NewTicker(frameDuration)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				fn()
+			}
+		}
+	})
+}
+
+// close stops the goroutine of start, if it was started, and waits for it to return
+func (p *pacer) close() {
+	if p.stop == nil {
+		return
+	}
+	close(p.stop)
+	p.wg.Wait()
+	p.stop = nil
+}
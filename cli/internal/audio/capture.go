@@ -2,30 +2,23 @@ package audio
 
 import (
 	"context"
-	"encoding/binary"
 	"fmt"
 	"log"
-	"sync"
-	"time"
+	"strings"
+	"sync/atomic"
 
-	"github.com/gen2brain/malgo"
 	"github.com/pion/webrtc/v4"
 	"github.com/pion/webrtc/v4/pkg/media"
 	"gopkg.in/hraban/opus.v2"
 )
 
-// AudioBuffer is a shared buffer that is written to/from the network and read/written by malgo for playback
-type AudioBuffer struct {
-	mu   sync.Mutex
-	data []int16
-}
-
-func StartCapture(ctx context.Context, pc *webrtc.PeerConnection, track *webrtc.TrackLocalStaticSample) error {
-	deviceCtx, device, pcm, initErr := initCaptureDevice()
-	defer uninitCapture(deviceCtx, device)
-	if initErr != nil {
-		return fmt.Errorf("error initalizing capture device: %w", initErr)
-	}
+// StartCapture captures audio from source, encoding it to opus and writing it to track until ctx is cancelled.
+// Each frame is encoded as soon as source has produced it, so capture runs on the clock of source.
+// While muted is set, silence is sent instead, so that the stream keeps its timing. muted may be nil.
+// If the codec of track advertises in-band FEC, each packet carries a copy of the previous one at a lower bitrate,
+// which the reciever decodes if the previous packet was lost. source is closed once capture stops.
+func StartCapture(ctx context.Context, source Source, track *webrtc.TrackLocalStaticSample, muted *atomic.Bool) error {
+	defer source.Close()
 
 	opusBuffer := make([]byte, opusBufferSize)
 	encoder, encErr := opus.NewEncoder(SampleRate, NumChannels, opus.AppVoIP)
@@ -33,30 +26,51 @@ func StartCapture(ctx context.Context, pc *webrtc.PeerConnection, track *webrtc.
 		return fmt.Errorf("encoder error: %w", encErr)
 	}
 	// complexity, _ := encoder.Complexity()
-	// encoder.SetInBandFEC(true)  // adds latency, probably use PLC
+	if strings.Contains(track.Codec().SDPFmtpLine, "useinbandfec=1") {
+		if err := enableFEC(encoder); err != nil {
+			return err
+		}
+	}
 
-	// TODO: shorten this?
-	ticker := time.NewTicker(frameDuration)
-	defer ticker.Stop()
+	pcm := newRingBuffer(ringCapacity)
+	defer func() {
+		overflows, underruns := pcm.stats()
+		log.Printf("capture buffer: %d overflows, %d underruns", overflows, underruns)
+	}()
+
+	// signalled by source once a frame is buffered. it holds one signal, since the encoder drains every
+	// buffered frame when woken, so a signal that can't be sent means one is already pending
+	frames := make(chan struct{}, 1)
+	write := func(samples []int16) {
+		pcm.write(samples)
+		if pcm.available() >= frameSize {
+			select {
+			case frames <- struct{}{}:
+			default:
+			}
+		}
+	}
+	if err := source.Start(write); err != nil {
+		return err
+	}
+
+	frameData := make([]int16, frameSize)
 
 	// loop to encode buffered PCM into opus and send to network
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
-		case <-ticker.C:
-			pcm.mu.Lock()
+		case <-frames:
+		}
 
-			// Need at least one frame worth of data
-			if len(pcm.data) < frameSize {
-				pcm.mu.Unlock()
-				continue // wait for more data
-			}
+		// a device may deliver audio in periods that aren't a whole frame, so there may be more than one ready
+		for pcm.available() >= frameSize {
+			pcm.read(frameData)
 
-			// Extract one frame and remove it from the buffer
-			frameData := pcm.data[:frameSize]
-			pcm.data = pcm.data[frameSize:] // TODO: this may leak
-			pcm.mu.Unlock()
+			if muted != nil && muted.Load() {
+				clear(frameData)
+			}
 
 			// encode to opus
 			bytesEncoded, err := encoder.Encode(frameData, opusBuffer)
@@ -71,67 +85,24 @@ func StartCapture(ctx context.Context, pc *webrtc.PeerConnection, track *webrtc.
 				Duration: frameDuration,
 			})
 			if failedPeers != nil {
-				log.Println("WriteSample error, contains failed peers:", err)
+				log.Println("WriteSample error, contains failed peers:", failedPeers)
 				continue
 			}
 		}
 	}
 }
 
-func initCaptureDevice() (ctx *malgo.AllocatedContext, device *malgo.Device, pcm *AudioBuffer, err error) {
-	// configure playback device
-	ctx, err = malgo.InitContext(nil, malgo.ContextConfig{}, nil)
-	if err != nil {
-		err = fmt.Errorf("error initializing device context: %w", err)
-		return
-	}
-
-	deviceConfig := malgo.DefaultDeviceConfig(malgo.Capture)
-	deviceConfig.Capture.Format = AudioFormat
-	deviceConfig.Capture.Channels = NumChannels
-	deviceConfig.SampleRate = SampleRate
-	deviceConfig.PeriodSizeInMilliseconds = frameDurationMs
-
-	pcm = &AudioBuffer{}
-
-	// read into capture buffer, to write to network. this fires every X milliseconds
-	onRecvFrames := func(_, pInputSample []byte, framecount uint32) {
-		pcm.mu.Lock()
-		pcm.data = append(pcm.data, bytesToInt16(pInputSample)...)
-		pcm.mu.Unlock()
-	}
-
-	// init playback device
-	device, err = malgo.InitDevice(ctx.Context, deviceConfig, malgo.DeviceCallbacks{
-		Data: onRecvFrames,
-	})
-	if err != nil {
-		err = fmt.Errorf("error creating capture device: %w", err)
-		return
-	}
-	if err := device.Start(); err != nil {
-		err = fmt.Errorf("error starting capture device: %w", err)
-	}
-	return
-}
+// the packet loss, as a percentage, that the encoder expects when sending in-band FEC. This sets how much of the
+// bitrate FEC uses, and opus sends no FEC when it expects no loss.
+const fecPacketLoss = 10
 
-func uninitCapture(ctx *malgo.AllocatedContext, device *malgo.Device) {
-	if device != nil {
-		device.Uninit()
+// enableFEC makes encoder add in-band FEC to the packets it encodes
+func enableFEC(encoder *opus.Encoder) error {
+	if err := encoder.SetInBandFEC(true); err != nil {
+		return fmt.Errorf("error enabling fec: %w", err)
 	}
-	if err := ctx.Uninit(); err != nil {
-		fmt.Printf("error uninitializing capture device context: %v", err)
-	}
-	ctx.Free()
-	fmt.Println("uninit and freed capture device")
-}
-
-// bytesToInt16 turns a byte slice of PCM audio into an int16 slice for the opus encoder to use.
-// TODO: can replace this with an unsafe alternative that reinterprets the memory
-func bytesToInt16(b []byte) []int16 {
-	result := make([]int16, len(b)/2)
-	for i := range result {
-		result[i] = int16(binary.LittleEndian.Uint16(b[i*2:]))
+	if err := encoder.SetPacketLossPerc(fecPacketLoss); err != nil {
+		return fmt.Errorf("error setting expected packet loss: %w", err)
 	}
-	return result
+	return nil
 }
@@ -0,0 +1,133 @@
+package audio
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/gen2brain/malgo"
+)
+
+// microphone is a Source capturing audio from the default microphone with malgo
+type microphone struct {
+	ctx    *malgo.AllocatedContext
+	device *malgo.Device
+}
+
+// NewMicrophone returns a Source for the default microphone, which is initialized by Start
+func NewMicrophone() Source {
+	return &microphone{}
+}
+
+func (m *microphone) Start(write func(pcm []int16)) (err error) {
+	// pass each period of audio straight from the device's buffer to capture, to write to network. this fires
+	// every frameDurationMs milliseconds
+	onRecvFrames := func(_, pInputSample []byte, framecount uint32) {
+		write(int16s(pInputSample))
+	}
+	m.ctx, m.device, err = initDevice(malgo.Capture, malgo.DeviceCallbacks{
+		Data: onRecvFrames,
+	})
+	if err != nil {
+		return fmt.Errorf("error initalizing capture device: %w", err)
+	}
+	return nil
+}
+
+func (m *microphone) Close() error {
+	uninitDevice(m.ctx, m.device)
+	fmt.Println("uninit and freed capture device")
+	return nil
+}
+
+// speaker is a Sink playing audio on the default speaker with malgo
+type speaker struct {
+	ctx    *malgo.AllocatedContext
+	device *malgo.Device
+}
+
+// NewSpeaker returns a Sink for the default speaker, which is initialized by Start
+func NewSpeaker() Sink {
+	return &speaker{}
+}
+
+func (s *speaker) Start(read func(pcm []int16)) (err error) {
+	// read straight into output sample buf, for output to speaker device. this fires every X milliseconds
+	onSendFrames := func(pOutputSample, _ []byte, framecount uint32) {
+		read(int16s(pOutputSample))
+	}
+	s.ctx, s.device, err = initDevice(malgo.Playback, malgo.DeviceCallbacks{
+		Data: onSendFrames,
+	})
+	if err != nil {
+		return fmt.Errorf("error initalizing playback device: %w", err)
+	}
+	return nil
+}
+
+func (s *speaker) Close() error {
+	if s.ctx == nil {
+		fmt.Println("playback ctx uninit before init")
+		return nil
+	}
+	uninitDevice(s.ctx, s.device)
+	fmt.Println("uninit and freed playback device")
+	return nil
+}
+
+// initDevice initializes and starts a malgo capture or playback device for the audio format of calls
+func initDevice(deviceType malgo.DeviceType, callbacks malgo.DeviceCallbacks) (
+	ctx *malgo.AllocatedContext,
+	device *malgo.Device,
+	err error,
+) {
+	ctx, err = malgo.InitContext(nil, malgo.ContextConfig{}, nil)
+	if err != nil {
+		err = fmt.Errorf("error initializing device context: %w", err)
+		return
+	}
+
+	deviceConfig := malgo.DefaultDeviceConfig(deviceType)
+	if deviceType == malgo.Capture {
+		deviceConfig.Capture.Format = AudioFormat
+		deviceConfig.Capture.Channels = NumChannels
+	} else {
+		deviceConfig.Playback.Format = AudioFormat
+		deviceConfig.Playback.Channels = NumChannels
+	}
+	deviceConfig.SampleRate = SampleRate
+	deviceConfig.PeriodSizeInMilliseconds = frameDurationMs
+
+	device, err = malgo.InitDevice(ctx.Context, deviceConfig, callbacks)
+	if err != nil {
+		err = fmt.Errorf("error creating device: %w", err)
+		return
+	}
+	if err = device.Start(); err != nil {
+		err = fmt.Errorf("error starting device: %w", err)
+	}
+	return
+}
+
+// uninitDevice uninitializes a malgo device and frees its context, either of which may be nil
+func uninitDevice(ctx *malgo.AllocatedContext, device *malgo.Device) {
+	if device != nil {
+		device.Uninit()
+	}
+	if ctx == nil {
+		return
+	}
+	if err := ctx.Uninit(); err != nil {
+		fmt.Printf("error uninitializing device context: %v", err)
+	}
+	ctx.Free()
+}
+
+// int16s reinterprets a byte slice of PCM audio from a malgo device as samples, without copying, so that the
+// device callbacks don't allocate. This relies on malgo's buffers being in the native byte order of AudioFormat,
+// and aligned for it.
+func int16s(b []byte) []int16 {
+	if len(b) < 2 {
+		return nil
+	}
+	return unsafe.Slice((*int16)(unsafe.Pointer(unsafe.SliceData(b))), len(b)/2)
+}
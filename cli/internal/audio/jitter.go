@@ -0,0 +1,244 @@
+package audio
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// bounds of the delay the jitter buffer adds to remote audio
+	minJitterDelay = 2 * frameDuration
+	maxJitterDelay = 300 * time.Millisecond
+
+	// the target delay is this many times the measured jitter, on top of a packet
+	jitterDelayFactor = 4
+
+	// once the buffer holds this much more audio than its target delay, a packet is dropped every
+	// shrinkInterval frames until it doesn't, so that the delay shrinks without being heard much
+	jitterExcess   = 2 * frameDuration
+	shrinkInterval = 10
+)
+
+// JitterStats describes the jitter buffer of a remote track
+type JitterStats struct {
+	// ID of the remote track
+	Track string
+
+	// packets recieved, those recieved after they should have been played, and those recieved more than once
+	Received, Late, Duplicate uint64
+
+	// packets that were never recieved in time to be played, and those dropped to shrink the delay
+	Lost, Dropped uint64
+
+	// lost packets whose following packet was buffered in time to recover them from its in-band FEC, if it has any,
+	// rather than concealing them with PLC
+	Recovered uint64
+
+	// times the buffer ran out of audio, after which it buffers up to its target delay again
+	Underruns uint64
+
+	// interarrival jitter of packets, as defined by RFC 3550
+	Jitter time.Duration
+
+	// the delay the buffer adapts to, from the jitter, and the delay of the audio it holds
+	TargetDelay, Delay time.Duration
+}
+
+// playout is what the jitter buffer has to play for a frame
+type playout int
+
+const (
+	// the buffer is filling up to its target delay, so there is nothing to play
+	playoutNothing playout = iota
+
+	playoutPacket
+
+	// the next packet was lost or is late, so its audio needs to be concealed
+	playoutLost
+
+	// the next packet was lost or is late, but the packet after it is buffered, and its in-band FEC may
+	// recover the lost audio
+	playoutFEC
+)
+
+// jitterBuffer reorders the RTP packets of a remote track by sequence number, holding them for long enough to
+// absorb the jitter of the network. Its delay adapts to the measured jitter, growing when the buffer runs out of
+// audio and shrinking when the network calms down. Packets are pushed as they're recieved and popped once per
+// packet duration.
+type jitterBuffer struct {
+	mu        sync.Mutex
+	clockRate uint32
+
+	// packets not yet played, by extended sequence number, which doesn't wrap
+	packets map[uint64]jitterPacket
+
+	// extended sequence numbers of the newest packet recieved, and of the next packet to play
+	highest, next uint64
+
+	started   bool
+	buffering bool
+
+	// RTP timestamp units in each packet, measured from consecutive packets
+	packetTicks uint32
+
+	// the arrival of the previous packet, and the interarrival jitter in seconds
+	lastArrival   time.Time
+	lastTimestamp uint32
+	jitter        float64
+
+	// frames played since a packet was last dropped
+	sinceDrop int
+
+	stats JitterStats
+}
+
+type jitterPacket struct {
+	timestamp uint32
+	payload   []byte
+}
+
+// newJitterBuffer creates a jitter buffer for packets with RTP timestamps of clockRate
+func newJitterBuffer(clockRate uint32) *jitterBuffer {
+	return &jitterBuffer{
+		clockRate:   clockRate,
+		packets:     make(map[uint64]jitterPacket),
+		packetTicks: clockRate / uint32(time.Second/frameDuration),
+	}
+}
+
+// push adds a packet recieved at arrival to the buffer, which keeps payload until it is popped. Packets that
+// arrive after they should have been played, or that are already buffered, are discarded.
+func (b *jitterBuffer) push(sequenceNumber uint16, timestamp uint32, payload []byte, arrival time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stats.Received++
+
+	if !b.started {
+		// start far from zero so that packets from before the first one recieved can't underflow
+		b.highest = 1<<32 + uint64(sequenceNumber)
+		b.next = b.highest
+		b.started, b.buffering = true, true
+	}
+	seq := uint64(int64(b.highest) + int64(int16(sequenceNumber-uint16(b.highest))))
+	if seq < b.next {
+		b.stats.Late++
+		return
+	}
+	if _, ok := b.packets[seq]; ok {
+		b.stats.Duplicate++
+		return
+	}
+	b.packets[seq] = jitterPacket{timestamp: timestamp, payload: payload}
+	b.highest = max(b.highest, seq)
+
+	if prev, ok := b.packets[seq-1]; ok {
+		if ticks := timestamp - prev.timestamp; ticks > 0 && ticks < b.clockRate {
+			b.packetTicks = ticks
+		}
+	}
+
+	// J(i) = J(i-1) + (|D(i-1,i)| - J(i-1))/16, from RFC 3550, with large gaps clamped so that
+	// a pause doesn't keep the delay high for long
+	if !b.lastArrival.IsZero() {
+		transit := arrival.Sub(b.lastArrival).Seconds() -
+			float64(int32(timestamp-b.lastTimestamp))/float64(b.clockRate)
+		d := min(math.Abs(transit), maxJitterDelay.Seconds())
+		b.jitter += (d - b.jitter) / 16
+	}
+	b.lastArrival, b.lastTimestamp = arrival, timestamp
+}
+
+// pop returns what to play for the next packet duration. Losses are detected from gaps in the sequence numbers.
+// The payload of the packet is returned, or for playoutFEC, the payload of the packet after the lost one.
+func (b *jitterBuffer) pop() ([]byte, playout) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.started {
+		return nil, playoutNothing
+	}
+	if b.buffering {
+		if b.delay() < b.target() {
+			return nil, playoutNothing
+		}
+		b.buffering = false
+	}
+	if b.highest < b.next {
+		b.stats.Underruns++
+		b.buffering = true
+		return nil, playoutNothing
+	}
+
+	// after a long gap, such as while reconnecting, skip to the newest audio rather than playing out the gap
+	if b.delay() > maxJitterDelay+jitterExcess {
+		b.skip(b.highest + 1 - uint64(b.target()/b.packetDuration()))
+	}
+
+	b.sinceDrop++
+	if b.sinceDrop >= shrinkInterval && b.delay() > b.target()+jitterExcess {
+		b.sinceDrop = 0
+		b.skip(b.next + 1)
+	}
+
+	packet, ok := b.packets[b.next]
+	delete(b.packets, b.next)
+	b.next++
+	if !ok {
+		b.stats.Lost++
+		if following, ok := b.packets[b.next]; ok {
+			b.stats.Recovered++
+			return following.payload, playoutFEC
+		}
+		return nil, playoutLost
+	}
+	return packet.payload, playoutPacket
+}
+
+// skip discards the packets before seq, which is played next
+func (b *jitterBuffer) skip(seq uint64) {
+	for ; b.next < seq; b.next++ {
+		if _, ok := b.packets[b.next]; ok {
+			delete(b.packets, b.next)
+			b.stats.Dropped++
+		} else {
+			b.stats.Lost++
+		}
+	}
+}
+
+// delay returns the duration of the audio from the next packet to play through the newest packet
+func (b *jitterBuffer) delay() time.Duration {
+	if b.highest < b.next {
+		return 0
+	}
+	return time.Duration(b.highest-b.next+1) * b.packetDuration()
+}
+
+// target returns the delay the buffer adapts to, which is enough to absorb the measured jitter
+func (b *jitterBuffer) target() time.Duration {
+	target := b.packetDuration() + time.Duration(jitterDelayFactor*b.jitter*float64(time.Second))
+	return min(max(target, minJitterDelay), maxJitterDelay)
+}
+
+func (b *jitterBuffer) packetDuration() time.Duration {
+	return time.Duration(b.packetTicks) * time.Second / time.Duration(b.clockRate)
+}
+
+// packetSamples returns the number of samples per channel in each packet
+func (b *jitterBuffer) packetSamples() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return int(b.packetDuration() * SampleRate / time.Second)
+}
+
+// report returns the stats of the buffer
+func (b *jitterBuffer) report() JitterStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := b.stats
+	stats.Jitter = time.Duration(b.jitter * float64(time.Second))
+	stats.TargetDelay = b.target()
+	stats.Delay = b.delay()
+	return stats
+}
@@ -0,0 +1,216 @@
+package audio
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// jitterStep pushes a packet that arrives at an offset from the start of a test, or pops what to play next
+type jitterStep struct {
+	seq uint16
+	at  time.Duration
+
+	// for a pop, what should be played, and the packet whose payload is returned for playoutPacket or playoutFEC
+	pop  bool
+	want playout
+}
+
+// push is a step that pushes packet seq, which arrives at the offset at
+func push(seq uint16, at time.Duration) jitterStep {
+	return jitterStep{seq: seq, at: at}
+}
+
+// pop is a step that pops want, with the payload of packet seq
+func pop(want playout, seq uint16) jitterStep {
+	return jitterStep{pop: true, want: want, seq: seq}
+}
+
+// popNothing is a step that pops nothing to play
+func popNothing() jitterStep {
+	return jitterStep{pop: true, want: playoutNothing}
+}
+
+// jitterPayload is the payload of a test packet, which identifies it
+func jitterPayload(seq uint16) []byte {
+	return []byte{byte(seq >> 8), byte(seq)}
+}
+
+// TestJitterBuffer pushes 20ms packets with synthetic arrival times and checks what is played and the stats
+// counted. Packets arriving every 20ms have no jitter, so the buffer holds the minimum delay of two packets.
+func TestJitterBuffer(t *testing.T) {
+	const frame = 20 * time.Millisecond
+	tests := []struct {
+		name string
+
+		// the sequence number of the first packet, from which RTP timestamps are counted
+		first uint16
+		steps []jitterStep
+
+		// only the counters are compared
+		want JitterStats
+
+		// if set, the target delay must be more than this once the steps are done
+		targetAbove time.Duration
+	}{
+		{
+			name:  "reordered within target delay",
+			first: 10,
+			steps: []jitterStep{
+				push(10, 0),
+				popNothing(),
+				push(12, 2*frame),
+				push(11, 2*frame+time.Millisecond),
+				pop(playoutPacket, 10),
+				pop(playoutPacket, 11),
+				pop(playoutPacket, 12),
+			},
+			want: JitterStats{Received: 3},
+		},
+		{
+			name:  "late and duplicate",
+			first: 1,
+			steps: []jitterStep{
+				push(1, 0),
+				push(2, frame),
+				pop(playoutPacket, 1),
+				push(2, frame+5*time.Millisecond),
+				push(1, frame+10*time.Millisecond),
+				pop(playoutPacket, 2),
+			},
+			want: JitterStats{Received: 4, Late: 1, Duplicate: 1},
+		},
+		{
+			name:  "loss with next packet buffered",
+			first: 1,
+			steps: []jitterStep{
+				push(1, 0),
+				push(3, 2*frame),
+				push(4, 3*frame),
+				pop(playoutPacket, 1),
+				pop(playoutFEC, 3),
+				pop(playoutPacket, 3),
+				pop(playoutPacket, 4),
+			},
+			want: JitterStats{Received: 3, Lost: 1, Recovered: 1},
+		},
+		{
+			name:  "loss without next packet buffered",
+			first: 1,
+			steps: []jitterStep{
+				push(1, 0),
+				push(2, frame),
+				push(5, 4*frame),
+				pop(playoutPacket, 1),
+				pop(playoutPacket, 2),
+				pop(playoutLost, 0),
+				pop(playoutFEC, 5),
+				pop(playoutPacket, 5),
+			},
+			want: JitterStats{Received: 3, Lost: 2, Recovered: 1},
+		},
+		{
+			name:  "sequence number wraparound",
+			first: 65534,
+			steps: []jitterStep{
+				push(65534, 0),
+				push(65535, frame),
+				push(0, 2*frame),
+				push(1, 3*frame),
+				pop(playoutPacket, 65534),
+				pop(playoutPacket, 65535),
+				pop(playoutPacket, 0),
+				pop(playoutPacket, 1),
+				push(65533, 4*frame),
+			},
+			want: JitterStats{Received: 5, Late: 1},
+		},
+		{
+			// after running out, the buffer waits for more than the minimum delay, since packets arrived in a burst
+			name:  "grows after underrun",
+			first: 1,
+			steps: []jitterStep{
+				push(1, 0),
+				push(2, frame),
+				pop(playoutPacket, 1),
+				pop(playoutPacket, 2),
+				popNothing(),
+				push(3, 10*frame),
+				push(4, 10*frame),
+				push(5, 10*frame),
+				popNothing(),
+				push(6, 10*frame),
+				pop(playoutPacket, 3),
+				pop(playoutPacket, 4),
+			},
+			want:        JitterStats{Received: 6, Underruns: 1},
+			targetAbove: minJitterDelay,
+		},
+		{
+			// audio that arrives after a long gap is skipped to the target delay before the newest packet
+			name:  "skips long gap",
+			first: 1,
+			steps: func() []jitterStep {
+				steps := []jitterStep{push(1, 0), push(2, frame), pop(playoutPacket, 1), pop(playoutPacket, 2)}
+				for seq := range uint16(18) {
+					steps = append(steps, push(seq+3, 100*frame))
+				}
+				return append(steps, pop(playoutPacket, 17), pop(playoutPacket, 18))
+			}(),
+			want: JitterStats{Received: 20, Dropped: 14},
+		},
+		{
+			// the burst is played out until the 10th frame, which drops a packet since far more than the
+			// target delay is still buffered
+			name:  "shrinks after burst",
+			first: 1,
+			steps: func() []jitterStep {
+				var steps []jitterStep
+				for seq := range uint16(16) {
+					steps = append(steps, push(seq+1, 0))
+				}
+				for seq := range uint16(9) {
+					steps = append(steps, pop(playoutPacket, seq+1))
+				}
+				for seq := range uint16(6) {
+					steps = append(steps, pop(playoutPacket, seq+11))
+				}
+				return steps
+			}(),
+			want: JitterStats{Received: 16, Dropped: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newJitterBuffer(48_000)
+			start := time.Now()
+			for i, step := range tt.steps {
+				if !step.pop {
+					timestamp := uint32(step.seq-tt.first) * 960
+					b.push(step.seq, timestamp, jitterPayload(step.seq), start.Add(step.at))
+					continue
+				}
+
+				payload, got := b.pop()
+				var want []byte
+				if step.want == playoutPacket || step.want == playoutFEC {
+					want = jitterPayload(step.seq)
+				}
+				if got != step.want || !slices.Equal(payload, want) {
+					t.Fatalf("step %d: popped %d with payload %v, want %d with payload %v",
+						i, got, payload, step.want, want)
+				}
+			}
+
+			stats := b.report()
+			if tt.targetAbove != 0 && stats.TargetDelay <= tt.targetAbove {
+				t.Errorf("target delay is %s, want more than %s", stats.TargetDelay, tt.targetAbove)
+			}
+			stats.Jitter, stats.TargetDelay, stats.Delay = 0, 0, 0
+			if stats != tt.want {
+				t.Errorf("stats are %+v, want %+v", stats, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package audio
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// mixer sums the audio of the remote tracks of a call for a sink. Each track has its own ring buffer, which its
+// playout writes decoded audio to, so that people talking at once are heard together rather than interleaved.
+// Tracks are added and removed while the sink reads, without the realtime callback of the sink waiting on a lock.
+type mixer struct {
+	// held while tracks are added or removed
+	mu sync.Mutex
+
+	// the buffers of the tracks being mixed. The slice is replaced rather than modified, so that read can use it
+	// without locking
+	streams atomic.Pointer[[]*ringBuffer]
+
+	// scratch space for read, which is only called by the sink
+	sum   []int32
+	track []int16
+}
+
+func newMixer() *mixer {
+	m := &mixer{}
+	m.streams.Store(&[]*ringBuffer{})
+	return m
+}
+
+// add creates the buffer of a track, which is mixed until it is removed
+func (m *mixer) add() *ringBuffer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pcm := newRingBuffer(ringCapacity)
+	streams := append(slices.Clone(*m.streams.Load()), pcm)
+	m.streams.Store(&streams)
+	return pcm
+}
+
+// remove stops mixing the track with the buffer pcm. Tracks are removed by their buffer rather than their ID,
+// since a track that replaces another, such as an SFU's track of a member that rejoined, may reuse its ID.
+func (m *mixer) remove(pcm *ringBuffer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	streams := slices.DeleteFunc(slices.Clone(*m.streams.Load()), func(s *ringBuffer) bool {
+		return s == pcm
+	})
+	m.streams.Store(&streams)
+}
+
+// read fills out with the sum of the audio buffered for each track, clipped to the range of a sample. A track
+// without enough audio buffered to fill out adds silence. It must only be called by one goroutine at a time.
+func (m *mixer) read(out []int16) {
+	if cap(m.sum) < len(out) {
+		m.sum, m.track = make([]int32, len(out)), make([]int16, len(out))
+	}
+	sum, track := m.sum[:len(out)], m.track[:len(out)]
+	clear(sum)
+
+	for _, stream := range *m.streams.Load() {
+		if !stream.read(track) {
+			continue
+		}
+		for i, sample := range track {
+			sum[i] += int32(sample)
+		}
+	}
+	for i, sample := range sum {
+		out[i] = int16(min(max(sample, math.MinInt16), math.MaxInt16))
+	}
+}
@@ -0,0 +1,47 @@
+package audio
+
+// nullSource is a Source that produces silence
+type nullSource struct {
+	pacer pacer
+}
+
+// NewNullSource returns a Source that sends silence in real time, for machines without a microphone
+func NewNullSource() Source {
+	return &nullSource{}
+}
+
+func (s *nullSource) Start(write func(pcm []int16)) error {
+	silence := make([]int16, frameSize)
+	s.pacer.start(func() {
+		write(silence)
+	})
+	return nil
+}
+
+func (s *nullSource) Close() error {
+	s.pacer.close()
+	return nil
+}
+
+// nullSink is a Sink that discards the audio it consumes
+type nullSink struct {
+	pacer pacer
+}
+
+// NewNullSink returns a Sink that consumes and discards audio in real time, for machines without a speaker
+func NewNullSink() Sink {
+	return &nullSink{}
+}
+
+func (s *nullSink) Start(read func(pcm []int16)) error {
+	frame := make([]int16, frameSize)
+	s.pacer.start(func() {
+		read(frame)
+	})
+	return nil
+}
+
+func (s *nullSink) Close() error {
+	s.pacer.close()
+	return nil
+}
@@ -1,45 +1,87 @@
 package audio
 
 import (
-	"encoding/binary"
 	"fmt"
 	"io"
 	"log"
+	"maps"
+	"slices"
 	"sync"
+	"time"
 
-	"github.com/gen2brain/malgo"
 	"github.com/pion/webrtc/v4"
 	"gopkg.in/hraban/opus.v2"
 )
 
-// SetupPlayback initializes the playback device with malgo, and defines the callback that is run per remote-track, that
-// reads the audio from the network and places it in the buffer for the playback device to read from
-func SetupPlayback(pc *webrtc.PeerConnection, wg *sync.WaitGroup) (
-	deviceCtx *malgo.AllocatedContext,
-	device *malgo.Device,
-	err error,
-) {
-	deviceCtx, device, pcm, err := initPlaybackDevice()
-	if err != nil {
-		err = fmt.Errorf("error initalizing playback device: %w", err)
-		return
-	}
+// Playback plays the audio of the remote tracks of one or more PeerConnections on a Sink, such as the default
+// speaker. In a channel's room, every PeerConnection of the mesh plays on the same Playback.
+type Playback struct {
+	mixer *mixer
+	sink  Sink
 
-	pcmBuffer := make([]int16, pcmBufferSize)
-	decoder, err := opus.NewDecoder(SampleRate, NumChannels)
-	if err != nil {
-		err = fmt.Errorf("decoder init error: %w", err)
-		return
+	// closed once the sink has started
+	ready chan struct{}
+
+	// the goroutines reading the remote tracks of each PeerConnection from the network
+	mu  sync.Mutex
+	pcs map[*webrtc.PeerConnection]*sync.WaitGroup
+
+	// the IDs of the remote tracks that are playing, by their jitter buffer, and the final stats of those that ended
+	tracks map[*jitterBuffer]string
+	ended  []JitterStats
+}
+
+// NewPlayback creates the playback of the remote tracks of the PeerConnections given to Add. The buffers of all
+// tracks are mixed for sink to read from.
+func NewPlayback(sink Sink) *Playback {
+	return &Playback{
+		mixer:  newMixer(),
+		sink:   sink,
+		ready:  make(chan struct{}),
+		pcs:    make(map[*webrtc.PeerConnection]*sync.WaitGroup),
+		tracks: make(map[*jitterBuffer]string),
 	}
+}
+
+// Add defines the callback that is run per remote-track of pc, that reads the audio from the network into a
+// jitter buffer, from which it is decoded and placed in a buffer of its own. It should be called before sink is
+// started with Start, which can be slow for a speaker, so that no track is missed if it arrives in the meantime.
+// Audio recieved before sink is ready is dropped rather than played late.
+func (p *Playback) Add(pc *webrtc.PeerConnection) {
+	wg := &sync.WaitGroup{}
+	p.mu.Lock()
+	p.pcs[pc] = wg
+	p.mu.Unlock()
 
 	// this func runs for every remote track connected to this peer connection
-	// this is where the decoder writes pcm from the network
+	// this is where packets from the network are buffered, to be decoded into pcm by playout
 	// note: realize that this code will run multiple times if more than one remote track is connected (multi-user voice chat)
 	// note: this callback should not panic
-	// TODO: mix audio here, maybe pull out
 	pc.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
 		wg.Add(1)
 		defer wg.Done()
+
+		// opus decoders are stateful, so each remote track (an SFU forwards several) needs its own
+		decoder, decErr := opus.NewDecoder(SampleRate, NumChannels)
+		if decErr != nil {
+			log.Println("DECODER INIT ERROR: ", decErr)
+			return
+		}
+		jitter, pcm := p.addTrack(track.ID(), track.Codec().ClockRate)
+		defer p.removeTrack(jitter, pcm)
+
+		var (
+			playout sync.WaitGroup
+			stop    = make(chan struct{})
+		)
+		playout.Go(func() {
+			p.playout(jitter, decoder, pcm, stop)
+		})
+		defer func() {
+			close(stop)
+			playout.Wait()
+		}()
+
 		for {
 			// this blocks until either a packet is fully read or the pc is shutdown (returns an io.EOF err)
 			packet, _, readErr := track.ReadRTP()
@@ -50,108 +92,161 @@ func SetupPlayback(pc *webrtc.PeerConnection, wg *sync.WaitGroup) (
 				log.Println("PACKET READ ERR: ", readErr)
 				continue // Temporary error, keep trying
 			}
-
-			// TODO: track.ID()
-			// - use track.id to store pcm in a buf for only this track
-			// - then mix PCM from each track before writing to speaker
-			// - each track's PCM needs a lock and so does the mixing PCM
-			// - just do naive mixing at first, dont do any fancy timing
-			// - itd be nice to extract some of this state out into a struct with funcs
-
-			// TODO: check for 0 samples decoded and call PLC?
-			samplesDecoded, decodeErr := decoder.Decode(packet.Payload, pcmBuffer)
-			if decodeErr != nil {
-				log.Println("DECODE ERROR: ", decodeErr.Error())
-				continue
+			if len(packet.Payload) == 0 {
+				continue // padding
 			}
 
-			framesDecoded := samplesDecoded * NumChannels
-			// Write decoded PCM to playback buffer, which malgo will pull from for playback
-			pcm.mu.Lock()
-			pcm.data = append(pcm.data, pcmBuffer[:framesDecoded]...)
-			pcm.mu.Unlock()
+			jitter.push(packet.SequenceNumber, packet.Timestamp, packet.Payload, time.Now())
 		}
 	})
-	return
 }
 
-func initPlaybackDevice() (ctx *malgo.AllocatedContext, device *malgo.Device, pcm *AudioBuffer, err error) {
-	// configure playback device
-	ctx, err = malgo.InitContext(nil, malgo.ContextConfig{}, nil)
-	if err != nil {
-		err = fmt.Errorf("error initializing device context: %w", err)
+// Remove stops playing the remote tracks of pc. First, it attempts a graceful close of pc, in order to unblock the
+// goroutines reading its tracks from the network, which are then waited on.
+func (p *Playback) Remove(pc *webrtc.PeerConnection) {
+	p.mu.Lock()
+	wg, exists := p.pcs[pc]
+	delete(p.pcs, pc)
+	p.mu.Unlock()
+	if !exists {
 		return
 	}
 
-	deviceConfig := malgo.DefaultDeviceConfig(malgo.Playback)
-	deviceConfig.Playback.Format = AudioFormat
-	deviceConfig.Playback.Channels = NumChannels
-	deviceConfig.SampleRate = SampleRate
-	deviceConfig.PeriodSizeInMilliseconds = frameDurationMs
-
-	pcm = &AudioBuffer{}
+	// this forces the track.ReadRTP() in the callback of Add to unblock
+	if closeErr := pc.GracefulClose(); closeErr != nil {
+		fmt.Printf("cannot gracefully close connection: %v\n", closeErr)
+	} else {
+		wg.Wait()
+	}
+}
 
-	// read into output sample buf, for output to speaker device. this fires every X milliseconds
-	onSendFrames := func(pOutputSample, _ []byte, framecount uint32) {
-		samplesToRead := framecount * NumChannels
-		pcm.mu.Lock()
-		defer pcm.mu.Unlock()
+// playout plays a remote track from its jitter buffer once per frame, until stop is closed. Packets are decoded
+// into pcm, the buffer of the track that is mixed for the sink.
+func (p *Playback) playout(jitter *jitterBuffer, decoder *opus.Decoder, pcm *ringBuffer, stop <-chan struct{}) {
+	pcmBuffer := make([]int16, pcmBufferSize)
+	ticker := time.NewTicker(frameDuration)
+	defer ticker.Stop()
 
-		// if there isn't yet a full sample in the pcmBuffer sent from the network
-		if len(pcm.data) < int(samplesToRead) {
+	for {
+		select {
+		case <-stop:
 			return
+		case <-ticker.C:
 		}
 
-		// write a full sample to the speaker buffer
-		copy(pOutputSample, int16ToBytes(pcm.data[:samplesToRead]))
-		pcm.data = pcm.data[samplesToRead:] // TODO: probably leaks
-	}
+		var samplesDecoded int
+		payload, next := jitter.pop()
+		switch next {
+		case playoutNothing:
+			continue
+		case playoutLost, playoutFEC:
+			// the decoder is told how much audio was lost by the size of the buffer it conceals it in
+			samplesDecoded = min(jitter.packetSamples(), pcmBufferSize/NumChannels)
+			if err := conceal(decoder, payload, pcmBuffer[:samplesDecoded*NumChannels]); err != nil {
+				log.Println("CONCEAL ERROR: ", err)
+				clear(pcmBuffer[:samplesDecoded*NumChannels])
+			}
+		case playoutPacket:
+			// decode even while the sink isn't ready, since the decoder's state depends on every packet
+			var decodeErr error
+			samplesDecoded, decodeErr = decoder.Decode(payload, pcmBuffer)
+			if decodeErr != nil {
+				log.Println("DECODE ERROR: ", decodeErr.Error())
+				continue
+			}
+		}
+		select {
+		case <-p.ready:
+		default:
+			continue
+		}
 
-	// init playback device
-	device, err = malgo.InitDevice(ctx.Context, deviceConfig, malgo.DeviceCallbacks{
-		Data: onSendFrames,
-	})
-	if err != nil {
-		err = fmt.Errorf("error creating playback device: %w", err)
-		return
-	}
-	if err := device.Start(); err != nil {
-		err = fmt.Errorf("error starting playback device: %w", err)
+		framesDecoded := samplesDecoded * NumChannels
+		// Write decoded PCM to the track's buffer, which the sink will pull from for playback, mixed with other tracks
+		pcm.write(pcmBuffer[:framesDecoded])
 	}
-	return
 }
 
-// UninitPlayback uninitializes the malgo playback device and frees all its resources. First, it attempts a graceful close
-// of the PeerConnection, in order to unblock the playback goroutine, which blocks while it reads packets from the network.
-// The playback wg is then waited on, while the goroutines reading from the network (RemoteTracks) complete. Regardless
-// of the result of the graceful close, the malgo device is torn down.
-func UninitPlayback(pc *webrtc.PeerConnection, ctx *malgo.AllocatedContext, device *malgo.Device, wg *sync.WaitGroup) {
-	// this forces the track.ReadRTP() in audio.SetupPlayback to unblock
-	if closeErr := pc.GracefulClose(); closeErr != nil {
-		fmt.Printf("cannot gracefully close recipient connection: %v\n", closeErr)
-	} else {
-		wg.Wait()
+// conceal fills pcm with audio for a lost packet. If the payload of the packet after it is given, its in-band FEC
+// recovers the lost audio, otherwise the decoder extrapolates it from the audio before it with PLC.
+func conceal(decoder *opus.Decoder, following []byte, pcm []int16) error {
+	if following != nil {
+		// falls back to PLC if the packet has no FEC
+		return decoder.DecodeFEC(following, pcm)
 	}
+	return decoder.DecodePLC(pcm)
+}
 
-	if ctx == nil {
-		fmt.Println("playback ctx uninit before init")
-		return
-	}
-	if device != nil {
-		device.Uninit()
+// addTrack creates the jitter buffer of a remote track, and the buffer its decoded audio is mixed from
+func (p *Playback) addTrack(id string, clockRate uint32) (*jitterBuffer, *ringBuffer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	jitter := newJitterBuffer(clockRate)
+	p.tracks[jitter] = id
+	return jitter, p.mixer.add()
+}
+
+// removeTrack removes the buffers of a remote track once it ends, logging their stats
+func (p *Playback) removeTrack(jitter *jitterBuffer, pcm *ringBuffer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mixer.remove(pcm)
+	id := p.tracks[jitter]
+	delete(p.tracks, jitter)
+
+	overflows, underruns := pcm.stats()
+	log.Printf("playback buffer of track %s: %d overflows, %d underruns", id, overflows, underruns)
+	stats := jitter.report()
+	stats.Track = id
+	log.Printf("jitter buffer of track %s: %+v", id, stats)
+	p.ended = append(p.ended, stats)
+}
+
+// Stats returns the stats of the jitter buffer of every remote track that has played, including those that ended
+func (p *Playback) Stats() []JitterStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := slices.Clone(p.ended)
+	for jitter, id := range p.tracks {
+		report := jitter.report()
+		report.Track = id
+		stats = append(stats, report)
 	}
-	if err := ctx.Uninit(); err != nil {
-		fmt.Printf("error uninitializing playback device context: %v", err)
+	return stats
+}
+
+// Start starts the sink, after which Ready is closed
+func (p *Playback) Start() error {
+	if err := p.sink.Start(p.read); err != nil {
+		return err
 	}
-	ctx.Free()
-	fmt.Println("uninit and freed playback device")
+	close(p.ready)
+	return nil
 }
 
-// int16ToBytes converts an int16 slice to a byte slice of PCM audio. TODO: can be reimpl with unsafe
-func int16ToBytes(s []int16) []byte {
-	result := make([]byte, len(s)*2)
-	for i, v := range s {
-		binary.LittleEndian.PutUint16(result[i*2:], uint16(v))
+// read fills pcm with the audio recieved from the network for the sink, mixed from each remote track, with silence
+// for the tracks that don't have enough yet
+func (p *Playback) read(pcm []int16) {
+	p.mixer.read(pcm)
+}
+
+// Ready returns a channel that is closed once the sink has started
+func (p *Playback) Ready() <-chan struct{} {
+	return p.ready
+}
+
+// Close closes the sink and frees all its resources. First, every PeerConnection that is still playing is removed,
+// which closes it and waits for the goroutines reading its tracks from the network (RemoteTracks) to complete.
+// Regardless of the result of the graceful closes, the sink is closed. It must not be called while Start is running.
+func (p *Playback) Close() {
+	p.mu.Lock()
+	pcs := slices.Collect(maps.Keys(p.pcs))
+	p.mu.Unlock()
+	for _, pc := range pcs {
+		p.Remove(pc)
+	}
+
+	if err := p.sink.Close(); err != nil {
+		fmt.Printf("error closing audio output: %v\n", err)
 	}
-	return result
 }
@@ -0,0 +1,81 @@
+package audio
+
+import "sync/atomic"
+
+// ringCapacity is the number of samples held by the ring buffers of capture and playback, about 340ms of audio
+const ringCapacity = 1 << 15
+
+// ringBuffer is a fixed-capacity buffer of PCM samples that one goroutine writes to and another reads from,
+// without locks, so that the realtime callback of an audio device never waits on the network, and never
+// allocates. Samples that don't fit are dropped and counted as an overflow, and reads that can't be filled
+// are counted as an underrun.
+type ringBuffer struct {
+	data []int16
+	mask uint64
+
+	// total samples read and written. readPos is only stored to by the reader, and writePos by the writer.
+	// they're padded onto separate cache lines so that the reader and writer don't contend over them
+	readPos  atomic.Uint64
+	_        [56]byte
+	writePos atomic.Uint64
+	_        [56]byte
+
+	overflows, underruns atomic.Uint64
+}
+
+// newRingBuffer creates a ring buffer holding at least capacity samples
+func newRingBuffer(capacity int) *ringBuffer {
+	size := 1
+	for size < capacity {
+		size <<= 1
+	}
+	return &ringBuffer{
+		data: make([]int16, size),
+		mask: uint64(size - 1),
+	}
+}
+
+// write appends samples to the buffer. If they don't all fit, those that don't are dropped.
+// It must only be called by one goroutine at a time.
+func (r *ringBuffer) write(samples []int16) {
+	w := r.writePos.Load()
+	free := uint64(len(r.data)) - (w - r.readPos.Load())
+	n := uint64(len(samples))
+	if n > free {
+		r.overflows.Add(1)
+		n = free
+	}
+
+	start := w & r.mask
+	copied := copy(r.data[start:], samples[:n])
+	copy(r.data, samples[copied:n])
+	r.writePos.Store(w + n)
+}
+
+// read fills out with the oldest samples in the buffer, removing them. false is returned, and nothing is read,
+// if the buffer doesn't hold enough samples to fill out. It must only be called by one goroutine at a time.
+func (r *ringBuffer) read(out []int16) bool {
+	rp := r.readPos.Load()
+	n := uint64(len(out))
+	if r.writePos.Load()-rp < n {
+		r.underruns.Add(1)
+		return false
+	}
+
+	start := rp & r.mask
+	copied := copy(out, r.data[start:])
+	copy(out[copied:], r.data[:n-uint64(copied)])
+	r.readPos.Store(rp + n)
+	return true
+}
+
+// available returns the number of samples in the buffer. It is exact when called by the reader, and otherwise
+// may already be out of date.
+func (r *ringBuffer) available() int {
+	return int(r.writePos.Load() - r.readPos.Load())
+}
+
+// stats returns the number of writes that overflowed the buffer, and of reads that it couldn't fill
+func (r *ringBuffer) stats() (overflows, underruns uint64) {
+	return r.overflows.Load(), r.underruns.Load()
+}
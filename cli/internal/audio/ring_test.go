@@ -0,0 +1,217 @@
+package audio
+
+import (
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// ringStep writes samples to a ring buffer if write is set, reads samples that should equal read if read is set,
+// and otherwise checks that reading n samples fails
+type ringStep struct {
+	write []int16
+	read  []int16
+	n     int
+}
+
+// TestRingBuffer runs writes and reads on a buffer of 8 samples, checking what is read and the overflows and
+// underruns counted
+func TestRingBuffer(t *testing.T) {
+	tests := []struct {
+		name                 string
+		steps                []ringStep
+		overflows, underruns uint64
+		available            int
+	}{
+		{
+			name: "fill",
+			steps: []ringStep{
+				{write: []int16{1, 2, 3, 4, 5, 6, 7, 8}},
+				{read: []int16{1, 2, 3, 4, 5, 6, 7, 8}},
+			},
+		},
+		{
+			name: "wraparound",
+			steps: []ringStep{
+				{write: []int16{1, 2, 3, 4, 5, 6}},
+				{read: []int16{1, 2, 3, 4}},
+				{write: []int16{7, 8, 9, 10, 11, 12}},
+				{read: []int16{5, 6, 7, 8, 9, 10, 11, 12}},
+				{write: []int16{13, 14, 15}},
+				{read: []int16{13, 14}},
+			},
+			available: 1,
+		},
+		{
+			name: "overflow",
+			steps: []ringStep{
+				{write: []int16{1, 2, 3, 4, 5}},
+				{write: []int16{6, 7, 8, 9, 10}},
+				{write: []int16{11}},
+				{read: []int16{1, 2, 3, 4, 5, 6, 7, 8}},
+				{write: []int16{12, 13}},
+				{read: []int16{12, 13}},
+			},
+			overflows: 2,
+		},
+		{
+			name: "underrun",
+			steps: []ringStep{
+				{n: 1},
+				{write: []int16{1, 2, 3}},
+				{n: 4},
+				{read: []int16{1, 2, 3}},
+				{n: 1},
+			},
+			underruns: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRingBuffer(8)
+			for i, step := range tt.steps {
+				switch {
+				case step.write != nil:
+					r.write(step.write)
+				case step.read != nil:
+					out := make([]int16, len(step.read))
+					if !r.read(out) {
+						t.Fatalf("step %d: read of %d samples failed with %d available", i, len(out), r.available())
+					}
+					if !slices.Equal(out, step.read) {
+						t.Fatalf("step %d: read %v, want %v", i, out, step.read)
+					}
+				default:
+					out := make([]int16, step.n)
+					if r.read(out) {
+						t.Fatalf("step %d: read of %d samples succeeded with %d available", i, step.n, r.available())
+					}
+					if slices.ContainsFunc(out, func(s int16) bool { return s != 0 }) {
+						t.Fatalf("step %d: failed read wrote %v", i, out)
+					}
+				}
+			}
+
+			overflows, underruns := r.stats()
+			if overflows != tt.overflows || underruns != tt.underruns {
+				t.Errorf("counted %d overflows and %d underruns, want %d and %d",
+					overflows, underruns, tt.overflows, tt.underruns)
+			}
+			if available := r.available(); available != tt.available {
+				t.Errorf("%d samples available, want %d", available, tt.available)
+			}
+		})
+	}
+}
+
+// TestRingBufferConcurrent writes chunks of varying sizes from one goroutine while they're read in frames from
+// another, checking that every sample is read once and in order. Run it with -race.
+func TestRingBufferConcurrent(t *testing.T) {
+	const total = 1 << 20
+	r := newRingBuffer(ringCapacity / 8)
+	capacity := len(r.data)
+
+	var writer sync.WaitGroup
+	writer.Go(func() {
+		in := make([]int16, frameSize+7)
+		var next int16
+		for written, size := 0, 1; written < total; size = size%len(in) + 1 {
+			n := min(size, total-written)
+			// only write what fits, so that no samples are dropped
+			for capacity-r.available() < n {
+				runtime.Gosched()
+			}
+			for j := range in[:n] {
+				in[j] = next
+				next++
+			}
+			r.write(in[:n])
+			written += n
+		}
+	})
+
+	out := make([]int16, frameSize)
+	var want int16
+	for read := 0; read < total; {
+		n := min(len(out), total-read)
+		if !r.read(out[:n]) {
+			runtime.Gosched()
+			continue
+		}
+		for _, sample := range out[:n] {
+			if sample != want {
+				t.Fatalf("read sample %d, want %d", sample, want)
+			}
+			want++
+		}
+		read += n
+	}
+	writer.Wait()
+
+	if overflows, _ := r.stats(); overflows != 0 {
+		t.Errorf("counted %d overflows, want 0", overflows)
+	}
+}
+
+// BenchmarkRingBuffer writes and reads a frame at a time from one goroutine, as in the steady state of a call
+func BenchmarkRingBuffer(b *testing.B) {
+	r := newRingBuffer(ringCapacity)
+	in, out := make([]int16, frameSize), make([]int16, frameSize)
+
+	b.ReportAllocs()
+	b.SetBytes(frameSize * 2)
+	for b.Loop() {
+		r.write(in)
+		if !r.read(out) {
+			b.Fatal("underrun")
+		}
+	}
+}
+
+// BenchmarkRingBufferConcurrent writes frames from one goroutine while they're read from another, like an audio
+// device and the network, checking that every sample is read once and in order
+func BenchmarkRingBufferConcurrent(b *testing.B) {
+	r := newRingBuffer(ringCapacity)
+
+	b.ReportAllocs()
+	b.SetBytes(frameSize * 2)
+	b.ResetTimer()
+
+	var writer sync.WaitGroup
+	writer.Go(func() {
+		in := make([]int16, frameSize)
+		var next int16
+		for i := 0; i < b.N; {
+			// only write what fits, so that no samples are dropped
+			if r.writePos.Load()-r.readPos.Load() > ringCapacity-frameSize {
+				runtime.Gosched()
+				continue
+			}
+			for j := range in {
+				in[j] = next
+				next++
+			}
+			r.write(in)
+			i++
+		}
+	})
+
+	out := make([]int16, frameSize)
+	var want int16
+	for i := 0; i < b.N; {
+		if !r.read(out) {
+			runtime.Gosched()
+			continue
+		}
+		for _, sample := range out {
+			if sample != want {
+				b.Fatalf("read sample %d, want %d", sample, want)
+			}
+			want++
+		}
+		i++
+	}
+	writer.Wait()
+}
@@ -0,0 +1,218 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// size of the header written by wavSink, which is the canonical header of a PCM WAV file
+const wavHeaderSize = 44
+
+// wavSource is a Source that reads audio from a WAV file
+type wavSource struct {
+	file  *os.File
+	r     *bufio.Reader
+	pacer pacer
+}
+
+// NewWAVSource returns a Source that reads audio from a WAV file in real time, followed by silence once the file
+// ends. The file must be 16-bit PCM with NumChannels channels at SampleRate, since audio isn't resampled.
+func NewWAVSource(path string) (Source, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(file)
+	if err = readWAVHeader(r); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return &wavSource{file: file, r: r}, nil
+}
+
+func (s *wavSource) Start(write func(pcm []int16)) error {
+	var (
+		frame = make([]int16, frameSize)
+		ended bool
+	)
+	s.pacer.start(func() {
+		if !ended {
+			err := binary.Read(s.r, binary.LittleEndian, frame)
+			if err != nil {
+				if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+					log.Printf("error reading wav file: %v", err)
+				}
+				ended = true
+			}
+		}
+		if ended {
+			clear(frame)
+		}
+		write(frame)
+	})
+	return nil
+}
+
+func (s *wavSource) Close() error {
+	s.pacer.close()
+	return s.file.Close()
+}
+
+// readWAVHeader reads the chunks of a WAV file up to the start of its audio, checking that the audio's format
+// matches that of calls
+func readWAVHeader(r io.Reader) error {
+	var riff struct {
+		ID   [4]byte
+		Size uint32
+		Type [4]byte
+	}
+	if err := binary.Read(r, binary.LittleEndian, &riff); err != nil {
+		return err
+	}
+	if string(riff.ID[:]) != "RIFF" || string(riff.Type[:]) != "WAVE" {
+		return errors.New("not a wav file")
+	}
+
+	var formatRead bool
+	for {
+		var chunk struct {
+			ID   [4]byte
+			Size uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &chunk); err != nil {
+			return fmt.Errorf("error reading chunk: %w", err)
+		}
+
+		switch string(chunk.ID[:]) {
+		case "fmt ":
+			var format struct {
+				AudioFormat   uint16
+				Channels      uint16
+				SampleRate    uint32
+				ByteRate      uint32
+				BlockAlign    uint16
+				BitsPerSample uint16
+			}
+			if err := binary.Read(r, binary.LittleEndian, &format); err != nil {
+				return fmt.Errorf("error reading format: %w", err)
+			}
+			if format.AudioFormat != 1 || format.Channels != NumChannels ||
+				format.SampleRate != SampleRate || format.BitsPerSample != 16 {
+				return fmt.Errorf("audio must be 16-bit PCM with %d channels at %d Hz", NumChannels, SampleRate)
+			}
+			if _, err := io.CopyN(io.Discard, r, int64(chunk.Size)-16); err != nil {
+				return err
+			}
+			formatRead = true
+		case "data":
+			if !formatRead {
+				return errors.New("audio before format")
+			}
+			return nil
+		default:
+			// chunks are padded to an even size
+			if _, err := io.CopyN(io.Discard, r, int64(chunk.Size+chunk.Size%2)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// wavSink is a Sink that writes audio to a WAV file
+type wavSink struct {
+	file  *os.File
+	w     *bufio.Writer
+	pacer pacer
+
+	// bytes of audio written
+	size uint32
+}
+
+// NewWAVSink returns a Sink that writes the audio it consumes in real time to a new WAV file,
+// replacing the file if it exists. The size of the audio is written to the file's header by Close.
+func NewWAVSink(path string) (Sink, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &wavSink{file: file, w: bufio.NewWriter(file)}
+	if err = s.writeHeader(); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *wavSink) Start(read func(pcm []int16)) error {
+	frame := make([]int16, frameSize)
+	s.pacer.start(func() {
+		read(frame)
+		if err := binary.Write(s.w, binary.LittleEndian, frame); err != nil {
+			log.Printf("error writing wav file: %v", err)
+			return
+		}
+		s.size += uint32(len(frame) * 2)
+	})
+	return nil
+}
+
+func (s *wavSink) Close() error {
+	s.pacer.close()
+	if err := s.w.Flush(); err != nil {
+		_ = s.file.Close()
+		return err
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		_ = s.file.Close()
+		return err
+	}
+	s.w.Reset(s.file)
+	if err := s.writeHeader(); err != nil {
+		_ = s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+// writeHeader writes the header of a PCM WAV file holding size bytes of audio
+func (s *wavSink) writeHeader() error {
+	const bytesPerSample = 2
+	header := struct {
+		RIFF          [4]byte
+		RIFFSize      uint32
+		WAVE          [4]byte
+		Fmt           [4]byte
+		FmtSize       uint32
+		AudioFormat   uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		Data          [4]byte
+		DataSize      uint32
+	}{
+		RIFF:          [4]byte{'R', 'I', 'F', 'F'},
+		RIFFSize:      wavHeaderSize - 8 + s.size,
+		WAVE:          [4]byte{'W', 'A', 'V', 'E'},
+		Fmt:           [4]byte{'f', 'm', 't', ' '},
+		FmtSize:       16,
+		AudioFormat:   1,
+		Channels:      NumChannels,
+		SampleRate:    SampleRate,
+		ByteRate:      SampleRate * NumChannels * bytesPerSample,
+		BlockAlign:    NumChannels * bytesPerSample,
+		BitsPerSample: bytesPerSample * 8,
+		Data:          [4]byte{'d', 'a', 't', 'a'},
+		DataSize:      s.size,
+	}
+	if err := binary.Write(s.w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
@@ -0,0 +1,110 @@
+package identity
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// certificateLifetime is how long the DTLS certificate is valid for. Friends pin its fingerprint,
+// so replacing it causes a warning on their next call.
+const certificateLifetime = 10 * 365 * 24 * time.Hour
+
+// fingerprintAlgorithm is the hash of a certificate that is pinned and compared
+const fingerprintAlgorithm = "sha-256"
+
+// LoadOrCreateCertificate loads the client's DTLS certificate from a PEM file, creating it if it doesn't exist.
+// pion generates a new certificate for every PeerConnection by default, so without this the fingerprint
+// of a client would change every call.
+func LoadOrCreateCertificate(file string) (*webrtc.Certificate, error) {
+	data, err := os.ReadFile(file)
+	if err == nil {
+		cert, err := webrtc.CertificateFromPEM(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing certificate file: %w", err)
+		}
+		return cert, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error reading certificate file: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating certificate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("error generating certificate serial: %w", err)
+	}
+	now := time.Now()
+	cert, err := webrtc.NewCertificate(key, x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "vogo"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(certificateLifetime),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating certificate: %w", err)
+	}
+
+	pem, err := cert.PEM()
+	if err != nil {
+		return nil, fmt.Errorf("error encoding certificate: %w", err)
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error creating certificate file: %w", err)
+	}
+	if _, err = f.WriteString(pem); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("error writing certificate file: %w", err)
+	}
+	if err = f.Close(); err != nil {
+		return nil, fmt.Errorf("error writing certificate file: %w", err)
+	}
+	return cert, nil
+}
+
+// Fingerprint returns the fingerprint of a certificate, as it appears in the client's session descriptions
+func Fingerprint(cert *webrtc.Certificate) (string, error) {
+	fingerprints, err := cert.GetFingerprints()
+	if err != nil {
+		return "", err
+	}
+	for _, fp := range fingerprints {
+		if strings.EqualFold(fp.Algorithm, fingerprintAlgorithm) {
+			return strings.ToUpper(fp.Value), nil
+		}
+	}
+	return "", fmt.Errorf("certificate has no %s fingerprint", fingerprintAlgorithm)
+}
+
+// RemoteFingerprint returns the fingerprint of the DTLS certificate in a peer's session description.
+// The DTLS handshake fails if the peer's certificate doesn't match it.
+func RemoteFingerprint(sd *webrtc.SessionDescription) (string, error) {
+	scanner := bufio.NewScanner(strings.NewReader(sd.SDP))
+	for scanner.Scan() {
+		attr, found := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "a=fingerprint:")
+		if !found {
+			continue
+		}
+		algorithm, value, found := strings.Cut(attr, " ")
+		if found && strings.EqualFold(algorithm, fingerprintAlgorithm) {
+			return strings.ToUpper(strings.TrimSpace(value)), nil
+		}
+	}
+	return "", fmt.Errorf("session description has no %s fingerprint", fingerprintAlgorithm)
+}
@@ -0,0 +1,79 @@
+// Package identity manages the ed25519 key pair that a user can authenticate to the vogo server with
+package identity
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gregriff/vogo/protocol"
+)
+
+const pemType = "PRIVATE KEY"
+
+// Generate creates a key pair and writes the private key to a PEM file readable only by the user.
+// An existing file is never overwritten.
+func Generate(file string) (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating key: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding key: %w", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der})
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error creating key file: %w", err)
+	}
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("error writing key file: %w", err)
+	}
+	if err = f.Close(); err != nil {
+		return nil, fmt.Errorf("error writing key file: %w", err)
+	}
+	return key, nil
+}
+
+// Load reads a private key written by Generate. The error wraps fs.ErrNotExist if there is no key file.
+func Load(file string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != pemType {
+		return nil, fmt.Errorf("key file %s is not a PEM private key", file)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing key file: %w", err)
+	}
+
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("key file does not contain an ed25519 key")
+	}
+	return edKey, nil
+}
+
+// PublicKey encodes the public key of a key pair as it is registered with the vogo server
+func PublicKey(key ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+}
+
+// SignChallenge signs a login challenge from the vogo server
+func SignChallenge(key ed25519.PrivateKey, username, challenge string) string {
+	message := protocol.ChallengeMessage(username, challenge)
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, message))
+}
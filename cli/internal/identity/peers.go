@@ -0,0 +1,120 @@
+package identity
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PinResult is the result of checking a peer's fingerprint against the one pinned for them
+type PinResult int
+
+const (
+	// the peer had no pinned fingerprint, and theirs was pinned
+	PinNew PinResult = iota
+
+	// the fingerprint matches the pinned fingerprint
+	PinMatch
+
+	// the fingerprint differs from the pinned fingerprint, which is kept
+	PinChanged
+)
+
+// Pin is the fingerprint of a friend's DTLS certificate, trusted on first use
+type Pin struct {
+	Fingerprint string
+	PinnedAt    time.Time
+}
+
+// Peers stores the pinned fingerprints of friends in a JSON file. It is safe for concurrent use.
+type Peers struct {
+	mu   sync.Mutex
+	file string
+	pins map[string]Pin
+}
+
+// LoadPeers reads the pinned fingerprints from a file. A missing file has no pins.
+func LoadPeers(file string) (*Peers, error) {
+	peers := &Peers{file: file, pins: make(map[string]Pin)}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return peers, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading known peers: %w", err)
+	}
+	if err = json.Unmarshal(data, &peers.pins); err != nil {
+		return nil, fmt.Errorf("error parsing known peers (%s): %w", file, err)
+	}
+	return peers, nil
+}
+
+// Check compares a friend's fingerprint to their pinned fingerprint, pinning it if they have none.
+// The pinned fingerprint is returned.
+func (p *Peers) Check(name, fingerprint string) (PinResult, Pin, error) {
+	name = strings.ToLower(name)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pin, exists := p.pins[name]; exists {
+		if pin.Fingerprint == fingerprint {
+			return PinMatch, pin, nil
+		}
+		return PinChanged, pin, nil
+	}
+
+	pin := Pin{Fingerprint: fingerprint, PinnedAt: time.Now()}
+	p.pins[name] = pin
+	return PinNew, pin, p.save()
+}
+
+// Get returns the pinned fingerprint of a friend
+func (p *Peers) Get(name string) (Pin, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pin, exists := p.pins[strings.ToLower(name)]
+	return pin, exists
+}
+
+// Forget removes the pinned fingerprint of a friend, so that the next one seen is pinned
+func (p *Peers) Forget(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.pins, strings.ToLower(name))
+	return p.save()
+}
+
+// save writes the pins to the file. p.mu must be held.
+func (p *Peers) save() error {
+	data, err := json.MarshalIndent(p.pins, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(p.file, data, 0o600); err != nil {
+		return fmt.Errorf("error writing known peers: %w", err)
+	}
+	return nil
+}
+
+// ShortAuthString derives a code from the fingerprints of both sides of a call, which is the same for either
+// side if neither fingerprint was replaced in transit. Friends read it to each other to verify their pins.
+func ShortAuthString(fingerprint, peerFingerprint string) string {
+	lo, hi := fingerprint, peerFingerprint
+	if hi < lo {
+		lo, hi = hi, lo
+	}
+	sum := sha256.Sum256([]byte("vogo-sas\x00" + lo + "\x00" + hi))
+
+	const digits = 1_000_000_000_000_000 // 15 digits
+	code := binary.BigEndian.Uint64(sum[:8]) % digits
+	return fmt.Sprintf("%05d %05d %05d", code/10_000_000_000, code/100_000%100_000, code%100_000)
+}
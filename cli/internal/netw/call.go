@@ -6,121 +6,29 @@ import (
 	"log"
 	"sync"
 
-	"github.com/gregriff/vogo/cli/internal/audio"
 	"github.com/gregriff/vogo/cli/internal/netw/wrtc"
+	"github.com/gregriff/vogo/protocol"
 	"github.com/pion/webrtc/v4"
-	"golang.org/x/net/websocket"
 )
 
-// CallFriend creates a bidirectional voice call to the intended recipient.
-// Signaling, speaker init, connecting and microphone init are all run concurrently,
-// organized with waitgroups and synchronized with channels. The entire process can
-// be cancelled with the provided context, and the first error encountered will be returned.
-func CallFriend(ctx context.Context, credentials *credentials, recipient string) error {
-	pc, track, candidates, connected, err := wrtc.NewAudioPeerConnection(credentials.stunServer, credentials.username, true)
-	if err != nil {
-		return fmt.Errorf("error initializing webrtc: %v", err)
-	}
-	defer wrtc.ClosePC(pc, true)
-
-	// sending an error on this channel will abort the call process
-	abort := make(chan error, 10)
-	defer func() {
-		log.Println("ABORT ERRS:")
-		select {
-		case err := <-abort:
-			log.Println(err)
-		default:
-			return
-		}
-	}()
-
-	// initalize speaker asynchronously
-	// var (
-	// 	playbackWg  sync.WaitGroup
-	// 	playbackCtx *malgo.AllocatedContext
-	// 	speaker     *malgo.Device
-	// )
-	// go func() {
-	// 	// TODO: mic capture needs to start after this is completed. add a noti chan
-	// 	playbackCtx, speaker, err = audio.SetupPlayback(pc, &playbackWg)
-	// 	if err != nil {
-	// 		abort <- fmt.Errorf("error initializing playback system: %w", err)
-	// 		return
-	// 	}
-	// 	log.Println("playback device created")
-	// }()
-	// defer audio.UninitPlayback(pc, playbackCtx, speaker, &playbackWg)
-
-	var call sync.WaitGroup
-	callCtx, cancelCall := context.WithCancel(ctx)
-	defer func() {
-		cancelCall()
-		call.Wait()
-	}()
-
-	call.Go(func() {
-		defer cancelCall()
-
-		err := sendCallAndConnect(callCtx, pc, credentials, recipient, candidates, abort)
-		if err != nil {
-			abort <- err
-			return
-		}
-	})
-
-	var capture sync.WaitGroup
-	captureCtx, cancelCapture := context.WithCancel(ctx)
-	defer func() {
-		cancelCapture()
-		capture.Wait()
-	}()
-
-	// setup microphone once call is connected and capture until cancelled
-	capture.Go(func() {
-		select {
-		case <-captureCtx.Done():
-			return
-		case <-connected:
-			cancelCall()
-			break
-		}
-		if err = audio.StartCapture(captureCtx, pc, track); err != nil {
-			abort <- fmt.Errorf("error with capture device: %w", err)
-			return
-		}
-	})
-
-	// block until sigint or error in goroutines above
-	select {
-	case err := <-abort:
-		return fmt.Errorf("call aborted: %w", err)
-	case <-ctx.Done():
-		return nil
-	}
-}
-
-// sendCallAndConnect creates and establishes a voice call with a friend client, if
-// they answer the call. It uses a websocket connection to a vogo server to handle
-// signaling and connecting, and uses trickle-ICE for fast connection. It assumes
-// a PeerConnection set up correctly for opus audio.
-func sendCallAndConnect(
-	ctx context.Context,
-	pc *webrtc.PeerConnection,
-	credentials *credentials,
-	recipient string,
-	candidates <-chan webrtc.ICECandidateInit,
-	abort chan<- error,
-) error {
-	ws, err := newWebsocket(ctx, credentials, "/call")
+// call creates and establishes a voice call with a friend client, if they answer the
+// call. It uses a websocket connection to a vogo server to handle signaling and
+// connecting, and uses trickle-ICE for fast connection. Once answered, the websocket stays
+// open for the rest of the call, so that the call can reconnect.
+func (s *Session) call(ctx context.Context, pc *wrtc.AudioPeerConnection, connected chan<- struct{}) error {
+	sig, err := newSignaler(ctx, s.credentials, "/call")
 	if err != nil {
 		return fmt.Errorf("error creating websocket: %w", err)
 	}
-	defer closeAndWait(ws, nil)
+	defer closeAndWait(sig.ws, nil)
 
-	if err = wrtc.CreateAndSendOffer(ws, pc, recipient); err != nil {
+	offer, err := wrtc.CreateOffer(pc.PC)
+	if err != nil {
 		return err
 	}
+	if err = sig.send(protocol.TypeOffer, protocol.Offer{Recipient: s.peer, SD: *offer}); err != nil {
+		return fmt.Errorf("error sending offer: %w", err)
+	}
 
 	var sendIce sync.WaitGroup
 	sendIceCtx, cancelSendIce := context.WithCancel(ctx)
@@ -129,82 +37,94 @@ func sendCallAndConnect(
 		sendIce.Wait()
 	}()
 
-	// gather local ice candidates and write to websocket
+	// gather local ice candidates and write to websocket, including those of ICE restarts
 	sendIce.Go(func() {
-		defer cancelSendIce()
-		if err = sendCandidates(sendIceCtx, ws, candidates); err != nil {
-			abort <- err // this will cause surrounding function to cancel
-		}
+		sendCandidates(sendIceCtx, sig, pc.Candidates)
 	})
 
-	// wait to recv answer
-	var answer webrtc.SessionDescription
-	if err = receiveWithContext(ctx, ws, &answer); err != nil {
-		return fmt.Errorf("error reading answer from ws: %v", err)
+	// wait to recv answer, which is preceded by a ringing control if the recipient is listening for calls
+	answer, err := s.recieveAnswer(ctx, sig)
+	if err != nil {
+		if ctx.Err() != nil {
+			// hung up before the recipient answered
+			_ = sig.sendControl(protocol.ControlCancelled)
+		}
+		return err
 	}
-	if err = pc.SetRemoteDescription(answer); err != nil {
+	s.credentials.verifyPeer(s.peer, answer)
+	if err = pc.PC.SetRemoteDescription(*answer); err != nil {
 		return fmt.Errorf("error while setting remote description: %w", err)
 	}
 	log.Println("recieved answer")
 
-	var (
-		readIce                   sync.WaitGroup
-		readIceCtx, cancelReadIce = context.WithCancel(ctx)
-		recipientCandidates       = make(chan webrtc.ICECandidateInit)
-	)
-	defer closeAndWait(ws, &readIce)
-	defer cancelReadIce()
+	s.setState(SessionConnecting)
+	return s.supervise(ctx, sig, pc, connected)
+}
 
-	// read recipient candidates from ws as they come in
-	readIce.Go(func() {
-		defer cancelReadIce()
-		err := readCandidates(readIceCtx, ws, recipientCandidates)
+// recieveAnswer reads from the websocket until the recipient's answer is read, moving the session to
+// SessionRinging when their client rings. If the call ends before it is answered, the error of its control
+// message is returned.
+func (s *Session) recieveAnswer(ctx context.Context, sig *signaler) (*webrtc.SessionDescription, error) {
+	for {
+		env, err := sig.receive(ctx)
 		if err != nil {
-			abort <- fmt.Errorf("error during readICE: %w", err)
+			return nil, fmt.Errorf("error reading answer from ws: %v", err)
 		}
-	})
-	if err = addCandidates(ctx, pc, recipientCandidates); err != nil {
-		return err
-	}
-	return nil
-}
 
-// sendCandidates sends the caller's ICE candidates from ch to the websocket as they're gathered.
-// It returns when there are no more candidates or the context is cancelled.
-func sendCandidates(ctx context.Context, ws *websocket.Conn, ch <-chan webrtc.ICECandidateInit) error {
-	defer log.Println("ice gathering completed")
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		case candidate, ok := <-ch:
-			if err := websocket.JSON.Send(ws, candidate); err != nil {
-				return fmt.Errorf("error sending ice candidate: %w", err)
+		switch env.Type {
+		case protocol.TypeAnswer:
+			var answer protocol.Answer
+			if err = env.Decode(&answer); err != nil {
+				return nil, fmt.Errorf("error decoding answer: %w", err)
+			}
+			return &answer.SD, nil
+		case protocol.TypeControl:
+			var control protocol.Control
+			if err = env.Decode(&control); err != nil {
+				return nil, err
 			}
-			log.Println("sent candidate")
-			if !ok {
-				return nil
+			if control.Control != protocol.ControlRinging {
+				return nil, controlError(control.Control)
 			}
+			log.Printf("%s is ringing", s.peer)
+			s.setState(SessionRinging)
+		default:
+			return nil, envelopeError(env)
 		}
 	}
 }
 
-// addCandidates adds the recipient's ICE candidates from ch to the peer connection. This function will continue
-// until its context is cancelled even once all candidates are exhausted.
-func addCandidates(ctx context.Context, pc *webrtc.PeerConnection, ch <-chan webrtc.ICECandidateInit) error {
+// sendCandidate sends one of the client's ICE candidates to the websocket. An empty candidate
+// is sent as the end of candidates.
+func sendCandidate(sig *signaler, candidate webrtc.ICECandidateInit) error {
+	var err error
+	if candidate.Candidate != "" {
+		err = sig.send(protocol.TypeCandidate, protocol.Candidate{Candidate: candidate})
+	} else {
+		err = sig.send(protocol.TypeEndOfCandidates, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("error sending ice candidate: %w", err)
+	}
+	log.Println("sent candidate")
+	return nil
+}
+
+// sendCandidates sends the client's ICE candidates from ch to the websocket as they're gathered, until the context
+// is cancelled. Gathering starts again after an ICE restart, so candidates are read for the whole call. Candidates
+// that cannot be sent are dropped, since the call may stay connected after signaling with the vogo server is lost.
+func sendCandidates(ctx context.Context, sig *signaler, ch <-chan webrtc.ICECandidateInit) {
 	for {
 		select {
 		case <-ctx.Done():
-			return nil
-		case candidate, ok := <-ch: // from the websocket
-			if !ok {
-				log.Println("no more recipient candidates")
-				ch = nil
+			return
+		case candidate := <-ch:
+			if err := sendCandidate(sig, candidate); err != nil {
+				log.Println(err)
 				continue
 			}
-			log.Println("recv recipient candidate")
-			if err := pc.AddICECandidate(candidate); err != nil {
-				return fmt.Errorf("error recieving ICE candidate: %w", err)
+			if candidate.Candidate == "" {
+				log.Println("ice gathering completed")
 			}
 		}
 	}
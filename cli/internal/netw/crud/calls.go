@@ -0,0 +1,64 @@
+package crud
+
+// calls.go implements requests for the call history.
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// CallRecord is an entry of the call history: a 1:1 call with a Recipient, or a visit to a Channel's voice room
+type CallRecord struct {
+	Caller,
+	Recipient,
+	Channel string
+
+	// one of answered, missed, declined or failed
+	Outcome string
+
+	StartedAt time.Time
+
+	// nil if the server didn't see the call end, which is only seen for relayed 1:1 calls and channels
+	EndedAt *time.Time
+
+	// seconds from when the call was answered until it ended, nil if the server didn't see it end
+	Duration *int
+}
+
+type callsResponse struct {
+	Calls []CallRecord
+	More  bool
+}
+
+// Calls fetches a page of the call history, newest first. More is true if older calls remain.
+func Calls(client *http.Client, limit, offset int) (calls *callsResponse, err error) {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("offset", strconv.Itoa(offset))
+
+	res, err := client.Get("/calls?" + query.Encode())
+	if err != nil {
+		err = fmt.Errorf("request error: %w", err)
+		return
+	}
+
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		err = fmt.Errorf("request failed: %s", string(body))
+		return
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&calls); err != nil {
+		err = fmt.Errorf("json decode error: %w", err)
+		return
+	}
+	return
+}
@@ -8,12 +8,12 @@ import (
 	"time"
 )
 
-// NewClient provides an http.Client for miscellaneous requests to the vogo server
-func NewClient(baseUrl, username, password string) *http.Client {
+// NewClient provides an http.Client for miscellaneous requests to the vogo server, authenticated with a session token.
+// token may be empty for requests made before logging in.
+func NewClient(baseUrl, token string) *http.Client {
 	vogoTransport := transport{
 		BaseURL:               baseUrl,
-		Username:              username,
-		Password:              password,
+		Token:                 token,
 		MaxIdleConns:          10,
 		IdleConnTimeout:       30 * time.Second,
 		TLSHandshakeTimeout:   5 * time.Second,
@@ -29,15 +29,22 @@ func NewClient(baseUrl, username, password string) *http.Client {
 // transport allows custom attributes to be added to each HTTP request sent by an http.Client that uses this transport
 type transport struct {
 	BaseURL,
-	Username,
-	Password string
+	Token string
 	MaxIdleConns int
 	IdleConnTimeout,
 	TLSHandshakeTimeout,
 	ResponseHeaderTimeout time.Duration
 }
 
-// RoundTrip adds upon the normal http.Transport.RoundTrip() behavior to add basic auth and a base url to each request.
+// endpoints that are requested before the client has a session
+var unauthenticated = map[string]bool{
+	"/register":  true,
+	"/challenge": true,
+	"/login":     true,
+	"/refresh":   true,
+}
+
+// RoundTrip adds upon the normal http.Transport.RoundTrip() behavior to add a bearer token and a base url to each request.
 // Reference: https://cs.opensource.google/go/x/oauth2/+/refs/tags/v0.31.0:transport.go
 func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
 	url := req.URL.String()
@@ -51,8 +58,8 @@ func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
 	req.URL = newURL
 	log.Println("making request to vogo server: ", req.Proto, url)
 
-	if path != "/register" {
-		req.SetBasicAuth(t.Username, t.Password)
+	if !unauthenticated[path] && t.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.Token)
 	}
 	return http.DefaultTransport.RoundTrip(req)
 }
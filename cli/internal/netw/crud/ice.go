@@ -0,0 +1,39 @@
+package crud
+
+// ice.go implements requests for the ICE servers used to connect calls.
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/pion/webrtc/v4"
+)
+
+type iceServersResponse struct {
+	ICEServers []webrtc.ICEServer
+}
+
+// ICEServers fetches the STUN and TURN servers to connect calls with. TURN credentials issued by the
+// vogo server expire, so they should be fetched before each call.
+func ICEServers(client *http.Client) ([]webrtc.ICEServer, error) {
+	res, err := client.Get("/ice-servers")
+	if err != nil {
+		return nil, fmt.Errorf("request error: %w", err)
+	}
+
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("request failed: %s", string(body))
+	}
+
+	var servers iceServersResponse
+	if err = json.NewDecoder(res.Body).Decode(&servers); err != nil {
+		return nil, fmt.Errorf("json decode error: %w", err)
+	}
+	return servers.ICEServers, nil
+}
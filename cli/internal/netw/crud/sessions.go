@@ -0,0 +1,216 @@
+package crud
+
+// sessions.go implements logging in and out of the vogo server.
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Session is issued by the vogo server on login. Token authenticates requests until ExpiresAt,
+// after which RefreshToken can be exchanged for a new session until RefreshExpiresAt.
+type Session struct {
+	Token,
+	RefreshToken string
+
+	ExpiresAt,
+	RefreshExpiresAt time.Time
+}
+
+// Login creates a session given the user's credentials. This is the only request that sends the password.
+// device names the session in the user's list of sessions.
+func Login(client *http.Client, username, password, device string) (session *Session, err error) {
+	req := struct {
+		Name,
+		Password,
+		Device string
+	}{Name: username, Password: password, Device: device}
+
+	return postSession(client, "/login", req)
+}
+
+// Challenge requests a challenge to sign with the user's private key, to log in with LoginWithKey.
+func Challenge(client *http.Client, username string) (challenge string, err error) {
+	req := struct {
+		Name string
+	}{Name: username}
+
+	payload, err := json.Marshal(req)
+	if err != nil {
+		err = fmt.Errorf("json marshal err")
+		return
+	}
+
+	res, err := client.Post("/challenge",
+		"application/json; charset=utf-8",
+		bytes.NewReader(payload),
+	)
+	if err != nil {
+		err = fmt.Errorf("request error: %w", err)
+		return
+	}
+
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		err = fmt.Errorf("request failed: %s", string(body))
+		return
+	}
+
+	var data struct {
+		Challenge string
+	}
+	if err = json.NewDecoder(res.Body).Decode(&data); err != nil {
+		err = fmt.Errorf("json decode error: %w", err)
+		return
+	}
+	return data.Challenge, nil
+}
+
+// LoginWithKey creates a session given a challenge from Challenge and its signature made with the user's private key.
+// device names the session in the user's list of sessions.
+func LoginWithKey(client *http.Client, username, challenge, signature, device string) (session *Session, err error) {
+	req := struct {
+		Name,
+		Challenge,
+		Signature,
+		Device string
+	}{Name: username, Challenge: challenge, Signature: signature, Device: device}
+
+	return postSession(client, "/login", req)
+}
+
+// Refresh exchanges a refresh token for a new session token and refresh token.
+// The old refresh token can't be used again.
+func Refresh(client *http.Client, refreshToken string) (session *Session, err error) {
+	req := struct {
+		RefreshToken string
+	}{RefreshToken: refreshToken}
+
+	return postSession(client, "/refresh", req)
+}
+
+// Logout revokes the session whose token the client was created with.
+func Logout(client *http.Client) error {
+	res, err := client.Post("/logout", "application/json; charset=utf-8", nil)
+	if err != nil {
+		return fmt.Errorf("request error: %w", err)
+	}
+
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("request failed: %s", string(body))
+	}
+	return nil
+}
+
+// ActiveSession is a logged in client of the user
+type ActiveSession struct {
+	Id,
+	Device,
+	IP string
+
+	CreatedAt,
+	LastUsedAt time.Time
+
+	// true for the session of this client
+	Current bool
+}
+
+type sessionsResponse struct {
+	Sessions []ActiveSession
+}
+
+// Sessions fetches the user's sessions that haven't been revoked or expired, most recently used first.
+func Sessions(client *http.Client) (sessions []ActiveSession, err error) {
+	res, err := client.Get("/sessions")
+	if err != nil {
+		err = fmt.Errorf("request error: %w", err)
+		return
+	}
+
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		err = fmt.Errorf("request failed: %s", string(body))
+		return
+	}
+
+	var data sessionsResponse
+	if err = json.NewDecoder(res.Body).Decode(&data); err != nil {
+		err = fmt.Errorf("json decode error: %w", err)
+		return
+	}
+	return data.Sessions, nil
+}
+
+// RevokeSession revokes one of the user's sessions given its id.
+func RevokeSession(client *http.Client, id string) error {
+	req, err := http.NewRequest(http.MethodDelete, "/sessions/"+url.PathEscape(id), nil)
+	if err != nil {
+		return fmt.Errorf("request error: %w", err)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request error: %w", err)
+	}
+
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("request failed: %s", string(body))
+	}
+	return nil
+}
+
+// postSession posts req to an endpoint that responds with a session
+func postSession(client *http.Client, endpoint string, req any) (session *Session, err error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		err = fmt.Errorf("json marshal err")
+		return
+	}
+
+	res, err := client.Post(endpoint,
+		"application/json; charset=utf-8",
+		bytes.NewReader(payload),
+	)
+	if err != nil {
+		err = fmt.Errorf("request error: %w", err)
+		return
+	}
+
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		err = fmt.Errorf("request failed: %s", string(body))
+		return
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&session); err != nil {
+		err = fmt.Errorf("json decode error: %w", err)
+		return
+	}
+	return
+}
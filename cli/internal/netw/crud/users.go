@@ -11,14 +11,16 @@ import (
 
 type newUser struct {
 	Name,
-	Password string
+	Password,
+	PublicKey string
 	InviteCode string
 }
 
 // Register asks the vogo-server to create a new user given the provided credentials and returns
 // the official username and friend code if sucessful. It will exit if an error is encountered.
-func Register(client *http.Client, username, password, inviteCode string) (string, error) {
-	newUser := newUser{Name: username, Password: password, InviteCode: inviteCode}
+// Either password or publicKey may be empty.
+func Register(client *http.Client, username, password, publicKey, inviteCode string) (string, error) {
+	newUser := newUser{Name: username, Password: password, PublicKey: publicKey, InviteCode: inviteCode}
 	payload, err := json.Marshal(newUser)
 	if err != nil {
 		return "", fmt.Errorf("json marshal error: %w", err)
@@ -63,13 +65,16 @@ type Channel struct {
 	Description string
 
 	Capacity int
+	Mode     string
 
 	MemberNames string
 }
 
 type statusResponse struct {
-	Friends  []Friend
-	Channels []Channel
+	Friends     []Friend
+	Channels    []Channel
+	MissedCalls []CallRecord
+	STUNServer  string
 }
 
 // Status fetches friends, channels, and incoming calls.
@@ -139,13 +144,14 @@ func AddFriend(client *http.Client, friendName string) (status *addFriendRespons
 	return
 }
 
-// CreateChannel creates a persistent voice-chat channel.
-func CreateChannel(client *http.Client, name, desc string, cap int) (channel *Channel, err error) {
+// CreateChannel creates a persistent voice-chat channel. An empty mode or a capacity of 0 uses the server's default.
+func CreateChannel(client *http.Client, name, desc, mode string, cap int) (channel *Channel, err error) {
 	req := struct {
 		Name,
-		Description string
+		Description,
+		Mode string
 		Capacity int
-	}{Name: name}
+	}{Name: name, Description: desc, Mode: mode, Capacity: cap}
 
 	payload, err := json.Marshal(req)
 	if err != nil {
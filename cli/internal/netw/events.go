@@ -0,0 +1,69 @@
+package netw
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// types of Event, matching the vogo server
+const (
+	EventIncomingCall   = "incoming_call"
+	EventCallCancelled  = "call_cancelled"
+	EventFriendRequest  = "friend_request"
+	EventFriendAccepted = "friend_accepted"
+	EventFriendOnline   = "friend_online"
+	EventChannelInvite  = "channel_invite"
+)
+
+// Event is pushed by the vogo server to clients listening for events
+type Event struct {
+	Type string
+
+	// name of the user that caused the event
+	From string
+
+	// name of the channel, for EventChannelInvite
+	Channel string
+
+	Time time.Time
+}
+
+// ListenEvents holds a websocket to the vogo server, sending every event it pushes to events, until the
+// context is cancelled or the connection is lost. Calls that are already waiting on the client are sent first.
+func ListenEvents(ctx context.Context, credentials *Credentials, events chan<- Event) error {
+	ws, err := newWebsocket(ctx, credentials, "/events")
+	if err != nil {
+		return fmt.Errorf("error creating websocket: %w", err)
+	}
+
+	var read sync.WaitGroup
+	defer closeAndWait(ws, &read)
+
+	readCtx, cancelRead := context.WithCancel(ctx)
+	defer cancelRead()
+
+	readErr := make(chan error, 1)
+	read.Go(func() {
+		for {
+			var event Event
+			if err := receiveWithContext(readCtx, ws, &event); err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case <-readCtx.Done():
+				return
+			case events <- event:
+			}
+		}
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-readErr:
+		return fmt.Errorf("error reading from ws: %w", err)
+	}
+}
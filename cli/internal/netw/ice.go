@@ -0,0 +1,32 @@
+package netw
+
+import (
+	"log"
+
+	"github.com/gregriff/vogo/cli/internal/netw/crud"
+	"github.com/pion/webrtc/v4"
+)
+
+// iceServers fetches the STUN and TURN servers from the vogo server, adding the configured STUN server if set.
+// If the vogo server cannot issue ICE servers, only the configured STUN server is used.
+func (c *Credentials) iceServers() []webrtc.ICEServer {
+	client := crud.NewClient(c.baseURL, c.token())
+	servers, err := crud.ICEServers(client)
+	if err != nil {
+		log.Printf("error fetching ice servers, using the configured stun server: %v", err)
+	}
+	if c.stunServer != "" {
+		servers = append(servers, webrtc.ICEServer{URLs: []string{c.stunServer}})
+	}
+	return servers
+}
+
+// peerConfig returns the configuration of the client's PeerConnections, with the ICE servers
+// from iceServers and the client's DTLS certificate
+func (c *Credentials) peerConfig() webrtc.Configuration {
+	config := webrtc.Configuration{ICEServers: c.iceServers()}
+	if c.certificate != nil {
+		config.Certificates = []webrtc.Certificate{*c.certificate}
+	}
+	return config
+}
@@ -0,0 +1,365 @@
+package netw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/gregriff/vogo/cli/internal/audio"
+	"github.com/gregriff/vogo/cli/internal/netw/wrtc"
+	"github.com/gregriff/vogo/protocol"
+	"github.com/pion/webrtc/v4"
+	"golang.org/x/net/websocket"
+)
+
+// JoinChannel joins the voice room of a channel, holding a PeerConnection to every other member
+// of the room (a full mesh) until the context is cancelled. Members already in the room send
+// offers to the client once it joins, and the client sends an offer to each member that joins after it.
+// Microphone audio is captured once and written to every PeerConnection through a shared track.
+// If the channel uses server-side media, the server is the only peer of the mesh, and sends every offer.
+// If fec is set, audio is sent with Opus in-band FEC.
+func JoinChannel(ctx context.Context, credentials *Credentials, channel string, fec bool) error {
+	endpoint := fmt.Sprintf("/channel/%s/join", url.PathEscape(channel))
+	cfg, err := newWebsocketConfig(credentials, endpoint)
+	if err != nil {
+		return fmt.Errorf("error creating websocket: %w", err)
+	}
+	cfg.Protocol = protocol.ChannelSubprotocols
+	ws, err := cfg.DialContext(ctx)
+	if err != nil {
+		return fmt.Errorf("error dialing ws: %w", err)
+	}
+
+	var joined protocol.ChannelMessage
+	if err = receiveWithContext(ctx, ws, &joined); err != nil {
+		closeAndWait(ws, nil)
+		return fmt.Errorf("error joining channel: %w", err)
+	}
+	if joined.Type == protocol.ChannelError {
+		closeAndWait(ws, nil)
+		return fmt.Errorf("error joining channel: %s", joined.Error)
+	}
+	if len(joined.Members) == 0 {
+		log.Printf("joined %s, waiting for others", channel)
+	} else {
+		log.Printf("joined %s with %s", channel, strings.Join(joined.Members, ", "))
+	}
+
+	track, err := wrtc.NewAudioTrack(credentials.username, fec)
+	if err != nil {
+		closeAndWait(ws, nil)
+		return fmt.Errorf("error initializing webrtc: %w", err)
+	}
+
+	// the audio of every member is mixed on one speaker
+	playback := audio.NewPlayback(audio.NewSpeaker())
+	if err = playback.Start(); err != nil {
+		playback.Close()
+		closeAndWait(ws, nil)
+		return fmt.Errorf("error initializing playback system: %w", err)
+	}
+
+	// sending an error on this channel will abort the call process
+	abort := make(chan error, 10)
+
+	var (
+		signaling                  sync.WaitGroup
+		signalingCtx, cancelSignal = context.WithCancel(ctx)
+		incoming                   = make(chan protocol.ChannelMessage)
+		outgoing                   = make(chan protocol.ChannelMessage, 32)
+	)
+	m := newMesh(signalingCtx, joined.Mode, credentials, track, playback, outgoing)
+	defer m.close()
+	defer func() {
+		cancelSignal()
+		closeAndWait(ws, &signaling)
+	}()
+
+	// the only writer to ws
+	signaling.Go(func() {
+		for {
+			select {
+			case <-signalingCtx.Done():
+				return
+			case msg := <-outgoing:
+				if err := websocket.JSON.Send(ws, msg); err != nil {
+					abort <- fmt.Errorf("error writing %s: %w", msg.Type, err)
+					return
+				}
+			}
+		}
+	})
+	signaling.Go(func() {
+		for {
+			var msg protocol.ChannelMessage
+			if err := receiveWithContext(signalingCtx, ws, &msg); err != nil {
+				if signalingCtx.Err() == nil {
+					abort <- fmt.Errorf("error reading from ws: %w", err)
+				}
+				return
+			}
+			select {
+			case <-signalingCtx.Done():
+				return
+			case incoming <- msg:
+			}
+		}
+	})
+
+	var capture sync.WaitGroup
+	captureCtx, cancelCapture := context.WithCancel(ctx)
+	defer func() {
+		cancelCapture()
+		capture.Wait()
+	}()
+
+	// the track is written to even while alone in the room, and is sent to peers as they connect
+	capture.Go(func() {
+		if err := audio.StartCapture(captureCtx, audio.NewMicrophone(), track, nil); err != nil {
+			abort <- fmt.Errorf("error with capture device: %w", err)
+		}
+	})
+
+	// block until ctrl C or an error in the goroutines above
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-abort:
+			return fmt.Errorf("left channel: %w", err)
+		case msg := <-incoming:
+			if err := m.handle(msg); err != nil {
+				log.Printf("error handling %s from %s: %v", msg.Type, msg.From, err)
+			}
+		}
+	}
+}
+
+// mesh holds a PeerConnection to each other member of a channel's room, or a single PeerConnection
+// to the server, named "", when the channel uses server-side media. The audio of every PeerConnection is
+// mixed by one playback. Its methods are not safe for concurrent use, and are only called from the
+// JoinChannel loop.
+type mesh struct {
+	ctx         context.Context
+	mode        string
+	credentials *Credentials
+	config      webrtc.Configuration
+	track       *webrtc.TrackLocalStaticSample
+	playback    *audio.Playback
+	outgoing    chan<- protocol.ChannelMessage
+	peers       map[string]*meshPeer
+}
+
+// meshPeer is the connection to a single member of the room
+type meshPeer struct {
+	name string
+	pc   *webrtc.PeerConnection
+
+	// candidates gathered before our offer or answer was sent to the member are held in pending,
+	// since the member cannot add candidates until it has our session description
+	mu       sync.Mutex
+	signaled bool
+	pending  []webrtc.ICECandidateInit
+}
+
+func newMesh(
+	ctx context.Context,
+	mode string,
+	credentials *Credentials,
+	track *webrtc.TrackLocalStaticSample,
+	playback *audio.Playback,
+	outgoing chan<- protocol.ChannelMessage,
+) *mesh {
+	return &mesh{
+		ctx:         ctx,
+		mode:        mode,
+		credentials: credentials,
+		config:      credentials.peerConfig(),
+		track:       track,
+		playback:    playback,
+		outgoing:    outgoing,
+		peers:       make(map[string]*meshPeer, 5),
+	}
+}
+
+// handle applies a message recieved from the room to the mesh
+func (m *mesh) handle(msg protocol.ChannelMessage) error {
+	switch msg.Type {
+	case protocol.ChannelJoined:
+		log.Printf("%s joined", msg.From)
+		if m.mode == protocol.ChannelModeMesh {
+			return m.offer(msg.From)
+		}
+	case protocol.ChannelLeft:
+		log.Printf("%s left", msg.From)
+		if m.mode == protocol.ChannelModeMesh {
+			m.remove(msg.From)
+		}
+	case protocol.ChannelOffer:
+		if msg.Sd == nil {
+			return errors.New("empty offer")
+		}
+		return m.answer(msg.From, *msg.Sd)
+	case protocol.ChannelAnswer:
+		peer, exists := m.peers[msg.From]
+		if !exists {
+			return errors.New("no offer was sent")
+		}
+		if msg.Sd == nil {
+			return errors.New("empty answer")
+		}
+		m.verify(msg.From, msg.Sd)
+		if err := peer.pc.SetRemoteDescription(*msg.Sd); err != nil {
+			return fmt.Errorf("error setting remote description: %w", err)
+		}
+	case protocol.ChannelCandidate:
+		peer, exists := m.peers[msg.From]
+		if !exists || msg.Candidate == nil {
+			return nil
+		}
+		if err := peer.pc.AddICECandidate(*msg.Candidate); err != nil {
+			return fmt.Errorf("error adding ICE candidate: %w", err)
+		}
+	case protocol.ChannelError:
+		log.Printf("server error: %s", msg.Error)
+	}
+	return nil
+}
+
+// offer creates a PeerConnection to a member that joined after us and sends them an offer
+func (m *mesh) offer(name string) error {
+	peer, err := m.addPeer(name)
+	if err != nil {
+		return err
+	}
+
+	offer, err := peer.pc.CreateOffer(nil)
+	if err != nil {
+		return fmt.Errorf("error creating offer: %w", err)
+	}
+	// starts ICE gathering and UDP listeners
+	if err = peer.pc.SetLocalDescription(offer); err != nil {
+		return fmt.Errorf("error setting local description: %w", err)
+	}
+	m.send(protocol.ChannelMessage{Type: protocol.ChannelOffer, To: name, Sd: &offer})
+	m.flushCandidates(peer)
+	return nil
+}
+
+// answer creates a PeerConnection to a member that was in the room before us and answers their offer.
+// If a PeerConnection to the member exists, the offer renegotiates it, as the server does when tracks
+// are added or removed.
+func (m *mesh) answer(name string, offer webrtc.SessionDescription) error {
+	peer, exists := m.peers[name]
+	if !exists {
+		var err error
+		if peer, err = m.addPeer(name); err != nil {
+			return err
+		}
+	}
+
+	m.verify(name, &offer)
+	if err := peer.pc.SetRemoteDescription(offer); err != nil {
+		return fmt.Errorf("error setting remote description: %w", err)
+	}
+	answer, err := peer.pc.CreateAnswer(nil)
+	if err != nil {
+		return fmt.Errorf("error creating answer: %w", err)
+	}
+	// starts ICE gathering and UDP listeners
+	if err = peer.pc.SetLocalDescription(answer); err != nil {
+		return fmt.Errorf("error setting local description: %w", err)
+	}
+	m.send(protocol.ChannelMessage{Type: protocol.ChannelAnswer, To: name, Sd: &answer})
+	m.flushCandidates(peer)
+	return nil
+}
+
+// verify checks the fingerprint of a member's session description. With server-side media,
+// the session description is the server's, so there is nothing to verify.
+func (m *mesh) verify(name string, sd *webrtc.SessionDescription) {
+	if m.mode == protocol.ChannelModeMesh {
+		m.credentials.verifyPeer(name, sd)
+	}
+}
+
+// addPeer creates a PeerConnection to a member, whose audio is mixed with the other members'.
+// An existing connection to the same member is replaced.
+func (m *mesh) addPeer(name string) (*meshPeer, error) {
+	m.remove(name)
+
+	pc, err := wrtc.NewMeshPeerConnection(m.config, m.track)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing webrtc: %w", err)
+	}
+	peer := &meshPeer{name: name, pc: pc}
+
+	pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+		if c == nil {
+			return // the member doesn't need to know that gathering completed
+		}
+		m.sendCandidate(peer, c.ToJSON())
+	})
+	pc.OnConnectionStateChange(func(s webrtc.PeerConnectionState) {
+		log.Printf("connection to %s has changed: %s", name, s.String())
+	})
+
+	m.playback.Add(pc)
+	m.peers[name] = peer
+	return peer, nil
+}
+
+// remove closes the PeerConnection of a member and stops playing their audio, if present
+func (m *mesh) remove(name string) {
+	peer, exists := m.peers[name]
+	if !exists {
+		return
+	}
+	delete(m.peers, name)
+	m.playback.Remove(peer.pc)
+}
+
+// close closes the connections to every member, then the playback device
+func (m *mesh) close() {
+	for name := range m.peers {
+		m.remove(name)
+	}
+	m.playback.Close()
+}
+
+// send queues a message to be written to the room's websocket
+func (m *mesh) send(msg protocol.ChannelMessage) {
+	select {
+	case <-m.ctx.Done():
+	case m.outgoing <- msg:
+	}
+}
+
+// sendCandidate sends a local ICE candidate to the member, or holds it until our session description is sent
+func (m *mesh) sendCandidate(peer *meshPeer, candidate webrtc.ICECandidateInit) {
+	peer.mu.Lock()
+	if !peer.signaled {
+		peer.pending = append(peer.pending, candidate)
+		peer.mu.Unlock()
+		return
+	}
+	peer.mu.Unlock()
+	m.send(protocol.ChannelMessage{Type: protocol.ChannelCandidate, To: peer.name, Candidate: &candidate})
+}
+
+// flushCandidates sends the candidates held while our session description was pending
+func (m *mesh) flushCandidates(peer *meshPeer) {
+	peer.mu.Lock()
+	peer.signaled = true
+	pending := peer.pending
+	peer.pending = nil
+	peer.mu.Unlock()
+
+	for _, candidate := range pending {
+		m.send(protocol.ChannelMessage{Type: protocol.ChannelCandidate, To: peer.name, Candidate: &candidate})
+	}
+}
@@ -0,0 +1,193 @@
+package netw
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gregriff/vogo/cli/internal/netw/wrtc"
+	"github.com/gregriff/vogo/protocol"
+	"github.com/pion/webrtc/v4"
+)
+
+// errors returned once a 1:1 call that has been answered ends
+var (
+	ErrHungUp         = errors.New("call ended")
+	ErrConnectionLost = errors.New("connection lost")
+)
+
+// how often the caller sends a new ICE restart offer while the call is disconnected
+const restartInterval = 5 * time.Second
+
+// supervise keeps the call going once its offer and answer have been exchanged, until ctx is cancelled, the other
+// client hangs up, or the call stays disconnected for longer than the grace period. It adds the other client's ICE
+// candidates as they're recieved, and when the PeerConnection disconnects or fails, renegotiates it through the vogo
+// server with ICE restart offers. connected is closed the first time the PeerConnection connects. ErrHungUp is
+// returned if the other client hung up, ErrConnectionLost if the call could not reconnect in time, and nil if ctx
+// is cancelled, after hanging up. If the vogo server stops relaying signaling messages, the call continues but can
+// no longer reconnect.
+func (s *Session) supervise(
+	ctx context.Context,
+	sig *signaler,
+	pc *wrtc.AudioPeerConnection,
+	connected chan<- struct{},
+) error {
+	var (
+		read                sync.WaitGroup
+		readCtx, cancelRead = context.WithCancel(ctx)
+		incoming            = make(chan protocol.Envelope)
+		readErr             = make(chan error, 1)
+	)
+	defer func() {
+		cancelRead()
+		read.Wait()
+	}()
+	read.Go(func() {
+		readErr <- readSignaling(readCtx, sig, incoming)
+	})
+
+	var (
+		grace        = time.NewTimer(s.grace)
+		restart      *time.Ticker
+		restartC     <-chan time.Time
+		wasConnected bool
+		reconnecting bool
+	)
+	defer grace.Stop()
+	stopRestarting := func() {
+		if restart != nil {
+			restart.Stop()
+			restart, restartC = nil, nil
+		}
+	}
+	defer stopRestarting()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if incoming != nil {
+				_ = sig.sendControl(protocol.ControlHangup)
+			}
+			return nil
+		case err := <-readErr:
+			if ctx.Err() == nil {
+				log.Printf("lost signaling with the vogo server, the call can no longer reconnect: %v", err)
+			}
+			incoming = nil
+		case env := <-incoming:
+			if err := s.handle(sig, pc.PC, env); err != nil {
+				return err
+			}
+		case <-pc.StateChanged:
+			switch pc.PC.ConnectionState() {
+			case webrtc.PeerConnectionStateConnected:
+				grace.Stop()
+				stopRestarting()
+				if !wasConnected {
+					wasConnected = true
+					close(connected)
+				}
+				reconnecting = false
+				s.setState(SessionConnected)
+			case webrtc.PeerConnectionStateDisconnected, webrtc.PeerConnectionStateFailed:
+				if !wasConnected || reconnecting {
+					continue
+				}
+				reconnecting = true
+				log.Printf("connection lost, reconnecting for up to %s", s.grace)
+				s.setState(SessionReconnecting)
+				grace.Reset(s.grace)
+				if s.initiator && incoming != nil {
+					s.restartICE(sig, pc.PC)
+					restart = time.NewTicker(restartInterval)
+					restartC = restart.C
+				}
+			case webrtc.PeerConnectionStateClosed:
+				return ErrHungUp
+			}
+		case <-restartC:
+			if incoming == nil {
+				stopRestarting()
+				continue
+			}
+			s.restartICE(sig, pc.PC)
+		case <-grace.C:
+			return ErrConnectionLost
+		}
+	}
+}
+
+// handle handles a signaling message relayed from the other client during the call. An error is returned
+// if the message ends the call.
+func (s *Session) handle(sig *signaler, pc *webrtc.PeerConnection, env protocol.Envelope) error {
+	switch env.Type {
+	case protocol.TypeCandidate:
+		var candidate protocol.Candidate
+		if err := env.Decode(&candidate); err != nil {
+			log.Println(err)
+			return nil
+		}
+		log.Printf("recv %s candidate", s.peer)
+		if err := pc.AddICECandidate(candidate.Candidate); err != nil {
+			log.Printf("error adding ICE candidate: %v", err)
+		}
+	case protocol.TypeEndOfCandidates:
+		log.Printf("no more %s candidates", s.peer)
+	case protocol.TypeOffer:
+		var offer protocol.Offer
+		if err := env.Decode(&offer); err != nil {
+			log.Println(err)
+			return nil
+		}
+		log.Println("recieved ice restart offer")
+		s.credentials.verifyPeer(s.peer, &offer.SD)
+		answer, err := wrtc.CreateAnswer(pc, &offer.SD)
+		if err != nil {
+			log.Printf("error answering ice restart: %v", err)
+			return nil
+		}
+		if err = sig.send(protocol.TypeAnswer, protocol.Answer{SD: *answer}); err != nil {
+			log.Printf("error sending answer: %v", err)
+		}
+	case protocol.TypeAnswer:
+		var answer protocol.Answer
+		if err := env.Decode(&answer); err != nil {
+			log.Println(err)
+			return nil
+		}
+		log.Println("recieved ice restart answer")
+		s.credentials.verifyPeer(s.peer, &answer.SD)
+		if err := pc.SetRemoteDescription(answer.SD); err != nil {
+			log.Printf("error while setting remote description: %v", err)
+		}
+	case protocol.TypeControl:
+		var control protocol.Control
+		if err := env.Decode(&control); err != nil {
+			return err
+		}
+		if control.Control == protocol.ControlHangup {
+			return ErrHungUp
+		}
+		return controlError(control.Control)
+	case protocol.TypeError:
+		log.Println(envelopeError(env))
+	default:
+		log.Printf("unexpected %s during call", env.Type)
+	}
+	return nil
+}
+
+// restartICE sends the other client an offer that restarts ICE, which gathers new candidates
+func (s *Session) restartICE(sig *signaler, pc *webrtc.PeerConnection) {
+	log.Println("restarting ice")
+	offer, err := wrtc.RestartICE(pc)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if err = sig.send(protocol.TypeOffer, protocol.Offer{SD: *offer}); err != nil {
+		log.Printf("error sending ice restart offer: %v", err)
+	}
+}
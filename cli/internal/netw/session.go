@@ -0,0 +1,336 @@
+package netw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gregriff/vogo/cli/internal/audio"
+	"github.com/gregriff/vogo/cli/internal/netw/wrtc"
+)
+
+// SessionState is the stage of a Session. A session moves forward through the states, except that a
+// connected session may move between SessionConnected and SessionReconnecting, and ends in SessionEnded.
+type SessionState string
+
+const (
+	// the session has not been started
+	SessionIdle SessionState = "idle"
+
+	// the caller is sending their offer, or the recipient is fetching it
+	SessionSignaling SessionState = "signaling"
+
+	// the recipient is listening for calls, and their client is ringing
+	SessionRinging SessionState = "ringing"
+
+	// the call was answered, and ICE candidates are being exchanged
+	SessionConnecting SessionState = "connecting"
+
+	SessionConnected SessionState = "connected"
+
+	// the connection was lost, and ICE is being restarted
+	SessionReconnecting SessionState = "reconnecting"
+
+	// the call ended. Session.Wait returns why
+	SessionEnded SessionState = "ended"
+)
+
+// SessionEvent reports that a Session moved to a new state
+type SessionEvent struct {
+	State SessionState
+
+	// why the session ended, for SessionEnded. nil if it was hung up by this client
+	Err error
+}
+
+// events that may wait to be read from Session.Events before newer ones are dropped
+const maxSessionEvents = 16
+
+// Session is a 1:1 voice call with a friend, from the side of either the caller or the recipient. It owns the
+// PeerConnection, the audio source and sink (by default the microphone and speaker), and the websocket to the vogo server used for signaling, for the
+// whole call. Sessions are created with NewCall or NewAnswer, run once started until they end, and cannot be reused.
+type Session struct {
+	credentials *Credentials
+
+	// name of the other client, and true if this client made the call. Only the caller makes ICE restart
+	// offers, so that both clients never restart at once.
+	peer      string
+	initiator bool
+
+	// how long the call may stay disconnected, or take to connect, before it is given up on
+	grace time.Duration
+
+	// where audio is captured from and played to. nil for the default microphone and speaker
+	source audio.Source
+	sink   audio.Sink
+
+	// send audio with Opus in-band FEC
+	fec bool
+
+	muted  atomic.Bool
+	events chan SessionEvent
+
+	// closed once the session ends
+	done chan struct{}
+
+	mu       sync.Mutex
+	state    SessionState
+	cancel   context.CancelFunc
+	err      error
+	playback *audio.Playback
+}
+
+// NewCall creates a session that calls a friend once started
+func NewCall(credentials *Credentials, recipient string, reconnectGrace time.Duration) *Session {
+	return newSession(credentials, recipient, true, reconnectGrace)
+}
+
+// NewAnswer creates a session that answers a friend's pending call once started
+func NewAnswer(credentials *Credentials, caller string, reconnectGrace time.Duration) *Session {
+	return newSession(credentials, caller, false, reconnectGrace)
+}
+
+func newSession(credentials *Credentials, peer string, initiator bool, reconnectGrace time.Duration) *Session {
+	return &Session{
+		credentials: credentials,
+		peer:        peer,
+		initiator:   initiator,
+		grace:       reconnectGrace,
+		events:      make(chan SessionEvent, maxSessionEvents),
+		done:        make(chan struct{}),
+		state:       SessionIdle,
+	}
+}
+
+// UseAudio sets where the session captures audio from and plays it to, instead of the default microphone and
+// speaker. It must be called before Start, and the session closes source and sink once it ends.
+func (s *Session) UseAudio(source audio.Source, sink audio.Sink) {
+	s.source, s.sink = source, sink
+}
+
+// UseFEC sends audio with Opus in-band FEC if fec is set, which lets the other client recover lost packets at
+// the cost of bitrate. It must be called before Start.
+func (s *Session) UseFEC(fec bool) {
+	s.fec = fec
+}
+
+// Start creates the PeerConnection and runs the call in the background, returning once it has started.
+// Signaling, speaker init, connecting and microphone init are all run concurrently. The call ends when ctx
+// is cancelled, Hangup is called, the other client hangs up, or the first error is encountered.
+func (s *Session) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return errors.New("session already started")
+	}
+
+	pc, err := wrtc.NewAudioPeerConnection(s.credentials.peerConfig(), s.credentials.username, s.fec)
+	if err != nil {
+		return fmt.Errorf("error initializing webrtc: %w", err)
+	}
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	go s.run(ctx, pc)
+	return nil
+}
+
+// Hangup ends the call, telling the other client. It does not wait for the session to end.
+func (s *Session) Hangup() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// Mute sends silence instead of the microphone's audio while muted is true
+func (s *Session) Mute(muted bool) {
+	s.muted.Store(muted)
+}
+
+// Muted returns true if the microphone is muted
+func (s *Session) Muted() bool {
+	return s.muted.Load()
+}
+
+// State returns the current state of the session
+func (s *Session) State() SessionState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Events returns a channel recieving each state the session moves to, which is closed once the session ends.
+// Events that aren't read in time are dropped, except for the last, SessionEnded.
+func (s *Session) Events() <-chan SessionEvent {
+	return s.events
+}
+
+// Wait blocks until a started session ends, returning why. If the call ended before connecting, the error wraps
+// ErrCallDeclined, ErrRecipientBusy or ErrCallTimeout. Once connected, ErrHungUp is returned if the other client
+// hung up, and ErrConnectionLost if the call stayed disconnected for longer than the reconnect grace period.
+// nil is returned if the call was hung up by this client.
+func (s *Session) Wait() error {
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// JitterStats returns the stats of the jitter buffer of each track of the other client's audio that has played,
+// including once the session has ended
+func (s *Session) JitterStats() []audio.JitterStats {
+	s.mu.Lock()
+	playback := s.playback
+	s.mu.Unlock()
+	if playback == nil {
+		return nil
+	}
+	return playback.Stats()
+}
+
+// setState moves the session to a new state, sending an event for it unless too many events are waiting
+func (s *Session) setState(state SessionState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == state || s.state == SessionEnded {
+		return
+	}
+	s.state = state
+
+	select {
+	case s.events <- SessionEvent{State: state}:
+	default:
+		log.Printf("dropped session event: %s", state)
+	}
+}
+
+// end moves the session to SessionEnded, and sends its event after dropping older events if needed
+func (s *Session) end(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state, s.err = SessionEnded, err
+
+	event := SessionEvent{State: SessionEnded, Err: err}
+	for {
+		select {
+		case s.events <- event:
+			close(s.events)
+			close(s.done)
+			return
+		default:
+		}
+		select {
+		case <-s.events:
+		default:
+		}
+	}
+}
+
+// run runs the call until ctx is cancelled or it ends, then ends the session
+func (s *Session) run(ctx context.Context, pc *wrtc.AudioPeerConnection) {
+	err := s.connect(ctx, pc)
+	s.Hangup() // releases the context
+	s.end(err)
+}
+
+// connect runs signaling, playback and capture for the call, organized with waitgroups and synchronized with
+// channels, and returns the first error encountered by any of them.
+func (s *Session) connect(ctx context.Context, pc *wrtc.AudioPeerConnection) error {
+	defer wrtc.ClosePC(pc.PC, true)
+	s.setState(SessionSignaling)
+
+	// sending an error on this channel will abort the call process
+	abort := make(chan error, 10)
+
+	source, sink := s.source, s.sink
+	if source == nil {
+		source = audio.NewMicrophone()
+	}
+	if sink == nil {
+		sink = audio.NewSpeaker()
+	}
+
+	// the speaker's callback is registered before signaling starts so that the remote track can't be missed,
+	// but the speaker is initialized asynchronously
+	var (
+		setup    sync.WaitGroup
+		playback = audio.NewPlayback(sink)
+	)
+	playback.Add(pc.PC)
+	s.mu.Lock()
+	s.playback = playback
+	s.mu.Unlock()
+	setup.Go(func() {
+		if err := playback.Start(); err != nil {
+			abort <- fmt.Errorf("error initializing playback system: %w", err)
+			return
+		}
+		log.Println("playback device created")
+	})
+	defer func() {
+		setup.Wait()
+		playback.Close()
+	}()
+
+	var (
+		signaling               sync.WaitGroup
+		signalingCtx, cancelSig = context.WithCancel(ctx)
+		connected               = make(chan struct{})
+	)
+	defer func() {
+		cancelSig()
+		signaling.Wait()
+	}()
+
+	signaling.Go(func() {
+		var err error
+		if s.initiator {
+			err = s.call(signalingCtx, pc, connected)
+		} else {
+			err = s.answer(signalingCtx, pc, connected)
+		}
+		if err != nil {
+			abort <- err
+		}
+	})
+
+	var capture sync.WaitGroup
+	captureCtx, cancelCapture := context.WithCancel(ctx)
+	defer func() {
+		cancelCapture()
+		capture.Wait()
+	}()
+
+	// setup microphone once call is connected and the speaker is ready, so that the call starts
+	// full-duplex, and capture until cancelled, including while reconnecting
+	capture.Go(func() {
+		for _, ready := range []<-chan struct{}{connected, playback.Ready()} {
+			select {
+			case <-captureCtx.Done():
+				_ = source.Close()
+				return
+			case <-ready:
+			}
+		}
+		if err := audio.StartCapture(captureCtx, source, pc.Track, &s.muted); err != nil {
+			abort <- fmt.Errorf("error with capture device: %w", err)
+		}
+	})
+
+	// block until hung up or an error in the goroutines above
+	select {
+	case err := <-abort:
+		if errors.Is(err, ErrHungUp) || errors.Is(err, ErrConnectionLost) {
+			return err
+		}
+		return fmt.Errorf("call aborted: %w", err)
+	case <-ctx.Done():
+		return nil
+	}
+}
@@ -0,0 +1,97 @@
+package netw
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gregriff/vogo/protocol"
+	"golang.org/x/net/websocket"
+)
+
+// signaler sends and recieves the protocol envelopes of a 1:1 call on a websocket to the vogo server
+type signaler struct {
+	ws    *websocket.Conn
+	codec websocket.Codec
+
+	// the negotiated protocol version, which is 0 for the legacy protocol
+	version int
+}
+
+// newSignaler creates a websocket connection to the vogo server to a given endpoint, offering every
+// supported signaling protocol version as its subprotocols
+func newSignaler(ctx context.Context, credentials *Credentials, endpoint string) (*signaler, error) {
+	cfg, err := newWebsocketConfig(credentials, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Protocol = protocol.Subprotocols
+
+	ws, err := cfg.DialContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error dialing ws: %w", err)
+	}
+
+	codec := protocol.NewCodec(ws.Config().Protocol)
+	return &signaler{
+		ws:      ws,
+		version: codec.Version(),
+		codec: websocket.Codec{
+			Marshal: func(v any) ([]byte, byte, error) {
+				data, err := codec.Marshal(v.(protocol.Envelope))
+				return data, websocket.TextFrame, err
+			},
+			Unmarshal: func(data []byte, _ byte, v any) error {
+				env, err := codec.Unmarshal(data)
+				*v.(*protocol.Envelope) = env
+				return err
+			},
+		},
+	}, nil
+}
+
+// send writes a message of a given type to the websocket. payload may be nil for types without one.
+func (s *signaler) send(t protocol.Type, payload any) error {
+	env, err := protocol.NewEnvelope(t, payload)
+	if err != nil {
+		return err
+	}
+	return s.codec.Send(s.ws, env)
+}
+
+// sendControl writes a control message to the websocket
+func (s *signaler) sendControl(control protocol.ControlType) error {
+	return s.send(protocol.TypeControl, protocol.Control{Control: control})
+}
+
+// relays returns true if the server keeps relaying signaling messages once the call connects
+func (s *signaler) relays() bool {
+	return s.version >= protocol.RelayVersion
+}
+
+// receive reads the next message from the websocket, cancelling the read if ctx is cancelled
+func (s *signaler) receive(ctx context.Context) (protocol.Envelope, error) {
+	var env protocol.Envelope
+	err := receiveCodecWithContext(ctx, s.ws, s.codec, &env)
+	return env, err
+}
+
+// envelopeError returns the error for a message that ends the signaling of a call: a control message
+// ending the call, an error from the server, or a message of an unexpected type
+func envelopeError(env protocol.Envelope) error {
+	switch env.Type {
+	case protocol.TypeControl:
+		var control protocol.Control
+		if err := env.Decode(&control); err != nil {
+			return err
+		}
+		return controlError(control.Control)
+	case protocol.TypeError:
+		var msg protocol.Error
+		if err := env.Decode(&msg); err != nil {
+			return err
+		}
+		return fmt.Errorf("server error: %s", msg.Message)
+	default:
+		return fmt.Errorf("unexpected message: %s", env.Type)
+	}
+}
@@ -0,0 +1,50 @@
+package netw
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/gregriff/vogo/cli/internal/identity"
+	"github.com/pion/webrtc/v4"
+)
+
+// verifyPeer checks the fingerprint of the DTLS certificate in a friend's session description against the
+// fingerprint pinned for them, pinning it if this is the first call with them. A changed fingerprint is warned
+// about loudly but doesn't end the call: either the friend's certificate was replaced, or the vogo server
+// or something between it and the friend rewrote the session description to intercept the call.
+func (c *Credentials) verifyPeer(name string, sd *webrtc.SessionDescription) {
+	if c.peers == nil {
+		return
+	}
+
+	fingerprint, err := identity.RemoteFingerprint(sd)
+	if err != nil {
+		log.Printf("cannot verify %s: %v", name, err)
+		return
+	}
+
+	result, pin, err := c.peers.Check(name, fingerprint)
+	if err != nil {
+		log.Printf("error pinning fingerprint of %s: %v", name, err)
+	}
+	switch result {
+	case identity.PinNew:
+		fmt.Printf("pinned the fingerprint of %s. compare codes with `vogo verify %s`\n", name, name)
+	case identity.PinMatch:
+		log.Printf("fingerprint of %s matches", name)
+	case identity.PinChanged:
+		fmt.Fprintf(os.Stderr, `
+@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@
+@   WARNING: THE FINGERPRINT OF %s HAS CHANGED!
+@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@
+Someone may be listening to this call by intercepting it at the vogo server.
+It is also possible that %s reinstalled vogo or deleted their certificate.
+pinned:    %s (on %s)
+this call: %s
+Ask %s over another channel. If they did replace their certificate,
+run 'vogo verify %s --forget' and call them again to pin the new one.
+
+`, name, name, pin.Fingerprint, pin.PinnedAt.Local().Format("Jan 2 2006"), fingerprint, name, name)
+	}
+}
@@ -2,41 +2,83 @@ package netw
 
 import (
 	"context"
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/gregriff/vogo/cli/internal/identity"
+	"github.com/gregriff/vogo/protocol"
 	"github.com/pion/webrtc/v4"
 	"golang.org/x/net/websocket"
 )
 
-// credentials are for signaling and connecting
-type credentials struct {
+// Credentials are for signaling and connecting
+type Credentials struct {
 	stunServer,
 	baseURL,
-	username,
-	password string
+	username string
+
+	// returns a session token that hasn't expired, which may be refreshed between calls
+	token func() string
+
+	// the client's persistent DTLS certificate, and the pinned certificate fingerprints of friends.
+	// a nil certificate uses a new certificate for each PeerConnection
+	certificate *webrtc.Certificate
+	peers       *identity.Peers
 }
 
 // NewCredentials creates credentials needed to make websocket requests
-// to the vogo server for signaling/connecting.
-func NewCredentials(stunServer, baseURL, username, password string) *credentials {
-	return &credentials{
-		stunServer: stunServer,
-		baseURL:    baseURL,
-		username:   username,
-		password:   password,
+// to the vogo server for signaling/connecting. token is called before each request,
+// so that long-running commands can refresh their session. The DTLS certificate is used
+// for every PeerConnection, and peers pins the fingerprints of friends' certificates.
+func NewCredentials(
+	stunServer, baseURL, username string,
+	token func() string,
+	certificate *webrtc.Certificate,
+	peers *identity.Peers,
+) *Credentials {
+	return &Credentials{
+		stunServer:  stunServer,
+		baseURL:     baseURL,
+		username:    username,
+		token:       token,
+		certificate: certificate,
+		peers:       peers,
+	}
+}
+
+// errors returned when the other side of a 1:1 call, or the vogo server, ends the call before it connects
+var (
+	ErrCallDeclined  = errors.New("call declined")
+	ErrCallCancelled = errors.New("call cancelled")
+	ErrRecipientBusy = errors.New("recipient is in another call")
+	ErrCallTimeout   = errors.New("call was not answered in time")
+)
+
+// controlError returns the error for a control message that ends a call
+func controlError(control protocol.ControlType) error {
+	switch control {
+	case protocol.ControlDeclined:
+		return ErrCallDeclined
+	case protocol.ControlCancelled:
+		return ErrCallCancelled
+	case protocol.ControlBusy:
+		return ErrRecipientBusy
+	case protocol.ControlTimeout:
+		return ErrCallTimeout
+	default:
+		return fmt.Errorf("unexpected control message: %s", control)
 	}
 }
 
 // newWebsocket creates a websocket connection to the vogo server to a given endpoint,
-// with http basic auth headers.
+// authenticated with a session token.
 func newWebsocket(
 	ctx context.Context,
-	credentials *credentials,
+	credentials *Credentials,
 	endpoint string,
 ) (*websocket.Conn, error) {
 	cfg, err := newWebsocketConfig(credentials, endpoint)
@@ -50,8 +92,8 @@ func newWebsocket(
 	return ws, nil
 }
 
-// newWebsocketConfig creates a new websocket.Config for the vogo server for a specific endpoint, with basic auth.
-func newWebsocketConfig(c *credentials, endpoint string) (*websocket.Config, error) {
+// newWebsocketConfig creates a new websocket.Config for the vogo server for a specific endpoint, with a bearer token.
+func newWebsocketConfig(c *Credentials, endpoint string) (*websocket.Config, error) {
 	loc := strings.Replace(c.baseURL, "http", "ws", 1) + endpoint
 	log.Println("ws url: ", loc)
 
@@ -60,40 +102,37 @@ func newWebsocketConfig(c *credentials, endpoint string) (*websocket.Config, err
 		return nil, err
 	}
 
-	// set basic auth for the http request that initates the ws connection
-	auth := c.username + ":" + c.password
-	auth = base64.StdEncoding.EncodeToString([]byte(auth))
-	cfg.Header.Set("Authorization", "Basic "+auth)
+	// authenticate the http request that initates the ws connection
+	cfg.Header.Set("Authorization", "Bearer "+c.token())
 
 	return cfg, nil
 }
 
-// readCandidates reads from ws in a loop, sending candidates read to the channel ch.
-// When an empty candidate is read, the channel is closed, signalling that ICE gather on this
-// websocket is finished. If the ws is closed or there is an error while reading, the ws is closed and the loop stops.
-func readCandidates(ctx context.Context, ws *websocket.Conn, ch chan webrtc.ICECandidateInit) error {
-	var candidate webrtc.ICECandidateInit
+// readSignaling reads messages from the signaler into ch until the websocket is closed or ctx is cancelled,
+// returning the error that stopped it
+func readSignaling(ctx context.Context, sig *signaler, ch chan<- protocol.Envelope) error {
 	for {
-		err := receiveWithContext(ctx, ws, &candidate)
+		env, err := sig.receive(ctx)
 		if err != nil {
-			// if err == io.EOF {
-			// 	return err
-			// }
 			return fmt.Errorf("error reading from ws: %w", err)
 		}
-
-		if candidate.Candidate == "" {
-			close(ch)
-			log.Println("ice gather completed")
-			return nil
+		select {
+		case ch <- env:
+		case <-ctx.Done():
+			return ctx.Err()
 		}
-		ch <- candidate
 	}
 }
 
 // receiveWithContext reads json into v from ws in a new goroutine and cancels
 // the read if ctx is cancelled. Param v should be a pointer.
 func receiveWithContext(ctx context.Context, ws *websocket.Conn, v any) error {
+	return receiveCodecWithContext(ctx, ws, websocket.JSON, v)
+}
+
+// receiveCodecWithContext reads into v from ws with codec in a new goroutine and cancels
+// the read if ctx is cancelled. Param v should be a pointer.
+func receiveCodecWithContext(ctx context.Context, ws *websocket.Conn, codec websocket.Codec, v any) error {
 	var (
 		recv sync.WaitGroup
 		done = make(chan error, 1)
@@ -101,7 +140,7 @@ func receiveWithContext(ctx context.Context, ws *websocket.Conn, v any) error {
 	defer recv.Wait()
 
 	recv.Go(func() {
-		done <- websocket.JSON.Receive(ws, v)
+		done <- codec.Receive(ws, v)
 	})
 
 	select {
@@ -4,11 +4,12 @@ package wrtc
 import (
 	"fmt"
 	"log"
-	"os"
 
 	"github.com/pion/webrtc/v4"
 )
 
+// onICECandidate sends a gathered candidate to ch. Gathering may start again after an ICE restart,
+// so the end of each round of gathering is sent as an empty candidate instead of closing ch.
 func onICECandidate(candidate *webrtc.ICECandidate, ch chan<- webrtc.ICECandidateInit) {
 	addr := "nil!"
 	if candidate != nil {
@@ -17,32 +18,19 @@ func onICECandidate(candidate *webrtc.ICECandidate, ch chan<- webrtc.ICECandidat
 	log.Printf("ICE candidate recieved: %s", addr)
 
 	if candidate == nil {
-		close(ch)
+		ch <- webrtc.ICECandidateInit{}
 		return
 	}
 	ch <- candidate.ToJSON()
 }
 
-func onConnectionStateChange(state webrtc.PeerConnectionState, ch chan<- struct{}, exitOnFail bool) {
+// onConnectionStateChange notifies ch that the state of the PeerConnection changed, without blocking. The
+// reader of ch should get the current state from the PeerConnection, since notifications may be coalesced.
+func onConnectionStateChange(state webrtc.PeerConnectionState, ch chan<- struct{}) {
 	fmt.Printf("Peer Connection State has changed: %s\n", state.String())
 
-	if state == webrtc.PeerConnectionStateConnected {
-		ch <- struct{}{}
-	}
-
-	if !exitOnFail {
-		return
-	}
-
-	if state == webrtc.PeerConnectionStateFailed {
-		// Wait until PeerConnection has had no network activity for 30 seconds or another failure.
-		// It may be reconnected using an ICE Restart.
-		// Use webrtc.PeerConnectionStateDisconnected if you are interested in detecting faster timeout.
-		// Note that the PeerConnection may come back from PeerConnectionStateDisconnected.
-		os.Exit(0)
-	}
-	// if PeerConnection was explicitly closed, this usually happens from a DTLS CloseNotify
-	if state == webrtc.PeerConnectionStateClosed {
-		os.Exit(0)
+	select {
+	case ch <- struct{}{}:
+	default:
 	}
 }
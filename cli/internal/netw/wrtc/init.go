@@ -8,62 +8,78 @@ import (
 	"github.com/pion/webrtc/v4"
 )
 
-var opusCodec = webrtc.RTPCodecCapability{
-	MimeType:     webrtc.MimeTypeOpus,
-	ClockRate:    audio.SampleRate,
-	Channels:     audio.NumChannels,
-	SDPFmtpLine:  "", // "minptime=10;useinbandfec=1",
-	RTCPFeedback: nil,
+// opusCodec returns the codec of the client's audio. If fec is set, it advertises that Opus in-band FEC
+// is sent and can be decoded, and audio.StartCapture encodes audio written to tracks of it with FEC.
+func opusCodec(fec bool) webrtc.RTPCodecCapability {
+	codec := webrtc.RTPCodecCapability{
+		MimeType:     webrtc.MimeTypeOpus,
+		ClockRate:    audio.SampleRate,
+		Channels:     audio.NumChannels,
+		SDPFmtpLine:  "",
+		RTCPFeedback: nil,
+	}
+	if fec {
+		codec.SDPFmtpLine = "minptime=10;useinbandfec=1"
+	}
+	return codec
+}
+
+// AudioPeerConnection is the PeerConnection of a bidirectional audio call, with what's needed to drive it
+type AudioPeerConnection struct {
+	PC *webrtc.PeerConnection
+
+	// microphone audio is written to this
+	Track *webrtc.TrackLocalStaticSample
+
+	// carries this client's ICE candidates as they're gathered. An empty candidate ends each round of gathering
+	Candidates <-chan webrtc.ICECandidateInit
+
+	// notified when the connection state of PC changes, which should then be read from PC
+	StateChanged <-chan struct{}
 }
 
-// NewAudioPeerConnection creates the PeerConnection for a bidirectional audio webrtc connection.
-// It also returns the TrackLocalStaticSample used to write microphone audio to, and two channels,
-// one for recieving the client's ICE candidates as they're gathered, and the other for signaling
-// when the PeerConnection moves to a connected state.
-// TODO: create a struct for this retval
-func NewAudioPeerConnection(stunServer, trackID string, exitOnFail bool) (
-	*webrtc.PeerConnection,
-	*webrtc.TrackLocalStaticSample,
-	chan webrtc.ICECandidateInit,
-	chan struct{},
-	error,
-) {
-	pc, err := newPeerConnection(stunServer)
+// NewAudioPeerConnection creates the PeerConnection for a bidirectional audio webrtc connection, with
+// the ICE servers and DTLS certificate of config, and an audio track to write microphone audio to.
+// If fec is set, the audio is sent with Opus in-band FEC.
+func NewAudioPeerConnection(config webrtc.Configuration, trackID string, fec bool) (*AudioPeerConnection, error) {
+	pc, err := newPeerConnection(config, opusCodec(fec))
 	if err != nil {
-		ClosePC(pc, true)
-		return pc, nil, nil, nil, fmt.Errorf("error creating peer connection %w", err)
+		return nil, fmt.Errorf("error creating peer connection %w", err)
 	}
 	// if _, err = pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio); err != nil {
 	// 	panic(err)
 	// }
-	track, err := createAudioTrack(pc, trackID)
+	track, err := createAudioTrack(pc, trackID, fec)
 	if err != nil {
 		ClosePC(pc, true)
-		return pc, track, nil, nil, fmt.Errorf("error creating audio track: %w", err)
+		return nil, fmt.Errorf("error creating audio track: %w", err)
 	}
 
 	var (
-		// carries this client's ICE candidates as they're gathered
-		candidates = make(chan webrtc.ICECandidateInit, 10)
-
-		// notification channel for when the peer connection becomes connected
-		connected = make(chan struct{})
+		candidates   = make(chan webrtc.ICECandidateInit, 10)
+		stateChanged = make(chan struct{}, 1)
 	)
 	pc.OnICECandidate(func(c *webrtc.ICECandidate) {
 		onICECandidate(c, candidates)
 	})
 	pc.OnConnectionStateChange(func(s webrtc.PeerConnectionState) {
-		onConnectionStateChange(s, connected, exitOnFail)
+		onConnectionStateChange(s, stateChanged)
 	})
-	return pc, track, candidates, connected, nil
+	return &AudioPeerConnection{
+		PC:           pc,
+		Track:        track,
+		Candidates:   candidates,
+		StateChanged: stateChanged,
+	}, nil
 }
 
-// newPeerConnection creates a PeerConnection configured with the Opus audio codec.
-// It sets the STUN server and configures the MTU to avoid packet read underruns.
-func newPeerConnection(stunServer string) (*webrtc.PeerConnection, error) {
+// newPeerConnection creates a PeerConnection configured with codec, the Opus audio codec.
+// config sets the STUN and TURN servers, and the client's DTLS certificate so that its fingerprint
+// stays the same across calls. It also configures the MTU to avoid packet read underruns.
+func newPeerConnection(config webrtc.Configuration, codec webrtc.RTPCodecCapability) (*webrtc.PeerConnection, error) {
 	mediaEngine := &webrtc.MediaEngine{}
 	codecParams := webrtc.RTPCodecParameters{
-		RTPCodecCapability: opusCodec,
+		RTPCodecCapability: codec,
 		PayloadType:        111, // should this be negotiated and not hard coded?
 	}
 	if err := mediaEngine.RegisterCodec(codecParams, webrtc.RTPCodecTypeAudio); err != nil {
@@ -76,11 +92,8 @@ func newPeerConnection(stunServer string) (*webrtc.PeerConnection, error) {
 	// for each PeerConnection.
 	// interceptorRegistry := &interceptor.Registry{}
 
-	// jitterBufferFactory, err := jitterbuffer.NewInterceptor()
-	// if err != nil {
-	// 	panic(err)
-	// }
-	// interceptorRegistry.Add(jitterBufferFactory)
+	// remote audio is reordered by the adaptive jitter buffer of audio.Playback rather than the jitterbuffer
+	// interceptor, since it needs to know of lost packets to conceal them
 
 	// Use the default set of Interceptors
 	// if err = webrtc.RegisterDefaultInterceptors(mediaEngine, interceptorRegistry); err != nil {
@@ -95,19 +108,12 @@ func newPeerConnection(stunServer string) (*webrtc.PeerConnection, error) {
 		webrtc.WithMediaEngine(mediaEngine),
 		webrtc.WithSettingEngine(settingEngine),
 	)
-	config := webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{
-				URLs: []string{stunServer},
-			},
-		},
-	}
 	return api.NewPeerConnection(config)
 }
 
 // createAudioTrack configures a PeerConnection with a bidirectional transceiver and creates
 // an Opus audio TrackLocalStaticSample, which is returned, to write captured audio to.
-func createAudioTrack(pc *webrtc.PeerConnection, trackID string) (*webrtc.TrackLocalStaticSample, error) {
+func createAudioTrack(pc *webrtc.PeerConnection, trackID string, fec bool) (*webrtc.TrackLocalStaticSample, error) {
 	audioTrsv, err := pc.AddTransceiverFromKind(
 		webrtc.RTPCodecTypeAudio,
 		webrtc.RTPTransceiverInit{
@@ -119,18 +125,47 @@ func createAudioTrack(pc *webrtc.PeerConnection, trackID string) (*webrtc.TrackL
 	}
 
 	// setup microphone capture track
+	captureTrack, err := NewAudioTrack(trackID, fec)
+	if err != nil {
+		return nil, err
+	}
+	audioTrsv.Sender().ReplaceTrack(captureTrack)
+	return captureTrack, nil
+}
+
+// NewAudioTrack creates an Opus audio TrackLocalStaticSample to write captured audio to, with in-band FEC if fec
+// is set. A track can be added to more than one PeerConnection, which is how a channel's mesh shares one microphone.
+func NewAudioTrack(trackID string, fec bool) (*webrtc.TrackLocalStaticSample, error) {
 	captureTrack, err := webrtc.NewTrackLocalStaticSample(
-		opusCodec,
+		opusCodec(fec),
 		"captureTrack",
 		"captureTrack"+trackID,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("error initalizing capture track: %v", err)
 	}
-	audioTrsv.Sender().ReplaceTrack(captureTrack)
 	return captureTrack, nil
 }
 
+// NewMeshPeerConnection creates a PeerConnection to one member of a channel's room, sending audio from
+// the shared track and recieving the member's audio. Unlike NewAudioPeerConnection, the caller is
+// responsible for the ICE candidate and connection state callbacks.
+func NewMeshPeerConnection(config webrtc.Configuration, track *webrtc.TrackLocalStaticSample) (*webrtc.PeerConnection, error) {
+	pc, err := newPeerConnection(config, track.Codec())
+	if err != nil {
+		return nil, fmt.Errorf("error creating peer connection %w", err)
+	}
+
+	_, err = pc.AddTransceiverFromTrack(track, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionSendrecv,
+	})
+	if err != nil {
+		ClosePC(pc, false)
+		return nil, fmt.Errorf("error adding transceiver: %v", err)
+	}
+	return pc, nil
+}
+
 func ClosePC(pc *webrtc.PeerConnection, verbose bool) {
 	if verbose {
 		log.Println("closing peer connection")
@@ -4,60 +4,51 @@ import (
 	"fmt"
 
 	"github.com/pion/webrtc/v4"
-	"golang.org/x/net/websocket"
 )
 
-type callRequest struct {
-	RecipientName string
-	Sd            webrtc.SessionDescription
-}
-
-type answerRequest struct {
-	CallerName string
-	Sd         webrtc.SessionDescription
-}
-
-// CreateAndSendOffer creates the offer, starts ICE gathering, and sends the offer over ws,
-// for the specified recipient (username)
-func CreateAndSendOffer(ws *websocket.Conn, pc *webrtc.PeerConnection, recipient string) error {
+// CreateOffer creates the offer and starts ICE gathering, returning the offer to be sent to the recipient
+func CreateOffer(pc *webrtc.PeerConnection) (*webrtc.SessionDescription, error) {
 	offer, err := pc.CreateOffer(nil)
 	if err != nil {
-		return fmt.Errorf("error creating offer: %v", err)
+		return nil, fmt.Errorf("error creating offer: %v", err)
 	}
 
 	// starts ICE gathering and UDP listeners
 	if err = pc.SetLocalDescription(offer); err != nil {
-		return fmt.Errorf("error setting local description: %v", err)
+		return nil, fmt.Errorf("error setting local description: %v", err)
 	}
+	return &offer, nil
+}
 
-	req := callRequest{RecipientName: recipient, Sd: offer}
-	if err = websocket.JSON.Send(ws, req); err != nil {
-		return fmt.Errorf("error sending offer: %w", err)
+// RestartICE creates an offer that restarts ICE on a connected PeerConnection and starts gathering new
+// candidates, returning the offer to be sent to the other client. The other client answers it with CreateAnswer.
+func RestartICE(pc *webrtc.PeerConnection) (*webrtc.SessionDescription, error) {
+	offer, err := pc.CreateOffer(&webrtc.OfferOptions{ICERestart: true})
+	if err != nil {
+		return nil, fmt.Errorf("error creating ice restart offer: %v", err)
+	}
+	if err = pc.SetLocalDescription(offer); err != nil {
+		return nil, fmt.Errorf("error setting local description: %v", err)
 	}
-	return nil
+	return &offer, nil
 }
 
-// CreateAndSendAnswer sets the remote description of the caller given their offer, creates the answer,
-// starts ICE gathering, then sends the answer to ws
-func CreateAndSendAnswer(ws *websocket.Conn, pc *webrtc.PeerConnection, offer *webrtc.SessionDescription, callerName string) error {
+// CreateAnswer sets the remote description of the caller given their offer, creates the answer,
+// and starts ICE gathering, returning the answer to be sent to the caller
+func CreateAnswer(pc *webrtc.PeerConnection, offer *webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
 	if err := pc.SetRemoteDescription(*offer); err != nil {
-		return fmt.Errorf("error setting remote description: %v", err)
+		return nil, fmt.Errorf("error setting remote description: %v", err)
 	}
 
 	answer, err := pc.CreateAnswer(nil)
 	if err != nil {
-		return fmt.Errorf("error creating answer: %v", err)
+		return nil, fmt.Errorf("error creating answer: %v", err)
 	}
 
 	// starts ICE gathering and UDP listeners
 	err = pc.SetLocalDescription(answer)
 	if err != nil {
-		return fmt.Errorf("error setting local description: %v", err)
-	}
-
-	req := answerRequest{CallerName: callerName, Sd: *pc.LocalDescription()}
-	if err = websocket.JSON.Send(ws, req); err != nil {
-		return fmt.Errorf("error sending answer: %w", err)
+		return nil, fmt.Errorf("error setting local description: %v", err)
 	}
-	return nil
+	return pc.LocalDescription(), nil
 }
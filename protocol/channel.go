@@ -0,0 +1,71 @@
+package protocol
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// ChannelSubprotocols are the websocket subprotocols of every supported version of the messages of channel voice
+// rooms, newest first. Unlike 1:1 calls, rooms have no legacy protocol, so clients must offer one of them.
+var ChannelSubprotocols = []string{"vogo.channel.v1"}
+
+// NegotiateChannel selects the subprotocol of the websocket of a channel's voice room from those offered by a
+// client, preferring the newest version. An error is returned if none of the offered subprotocols are supported.
+func NegotiateChannel(offered []string) ([]string, error) {
+	for _, subprotocol := range ChannelSubprotocols {
+		if slices.Contains(offered, subprotocol) {
+			return []string{subprotocol}, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported channel subprotocols: %v", offered)
+}
+
+// Modes of a channel's voice room. In a mesh, every member connects to every other member.
+// With an SFU, every member connects only to the server, which forwards each member's audio to the others.
+// With an MCU, the server mixes the audio of every other member into a single stream for each member.
+const (
+	ChannelModeMesh = "mesh"
+	ChannelModeSFU  = "sfu"
+	ChannelModeMCU  = "mcu"
+)
+
+// ChannelMessageType identifies the kind of a ChannelMessage
+type ChannelMessageType string
+
+const (
+	// sent by the server to a client that just joined, listing the members already present
+	ChannelMembers ChannelMessageType = "members"
+
+	// sent by the server to every member when another member joins or leaves
+	ChannelJoined ChannelMessageType = "joined"
+	ChannelLeft   ChannelMessageType = "left"
+
+	// sent by a client to another member, and forwarded by the server
+	ChannelOffer     ChannelMessageType = "offer"
+	ChannelAnswer    ChannelMessageType = "answer"
+	ChannelCandidate ChannelMessageType = "candidate"
+
+	// sent by the server when the client cannot join or a message cannot be forwarded
+	ChannelError ChannelMessageType = "error"
+)
+
+// ChannelMessage is a message sent as JSON over the websocket of a channel's voice room. In a mesh, each member
+// keeps one PeerConnection per other member, so offers, answers and candidates are addressed To a member
+// by name, and the server sets From to the sender's name when forwarding them. With server-side media,
+// members only connect to the server, which is addressed with an empty name.
+type ChannelMessage struct {
+	Type ChannelMessageType
+
+	From,
+	To string `json:",omitempty"`
+
+	// names of the members already in the room and the channel's mode, for ChannelMembers
+	Members []string `json:",omitempty"`
+	Mode    string   `json:",omitempty"`
+
+	Sd        *webrtc.SessionDescription `json:",omitempty"`
+	Candidate *webrtc.ICECandidateInit   `json:",omitempty"`
+	Error     string                     `json:",omitempty"`
+}
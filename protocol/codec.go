@@ -0,0 +1,209 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Subprotocol is the websocket subprotocol of the current protocol Version
+const Subprotocol = "vogo.v2"
+
+// Subprotocols are the websocket subprotocols of every supported version, newest first. Clients offer
+// all of them so that they can still connect to servers that only support older versions.
+var Subprotocols = []string{Subprotocol, "vogo.v1"}
+
+// ErrUnsupported is returned when encoding a message that the legacy protocol cannot express
+var ErrUnsupported = errors.New("message not supported by the legacy protocol")
+
+// Codec converts envelopes to and from the messages of a websocket, in the protocol version negotiated for it
+type Codec interface {
+	Marshal(env Envelope) ([]byte, error)
+	Unmarshal(data []byte) (Envelope, error)
+
+	// Version returns the negotiated protocol version, or 0 for the legacy protocol
+	Version() int
+}
+
+// Negotiate selects the subprotocol of a websocket from those offered by a client, preferring the newest version.
+// Clients that offer none use the legacy protocol, so none is selected. An error is returned if none of the offered
+// subprotocols are supported.
+func Negotiate(offered []string) ([]string, error) {
+	if len(offered) == 0 {
+		return nil, nil
+	}
+	for _, subprotocol := range Subprotocols {
+		if slices.Contains(offered, subprotocol) {
+			return []string{subprotocol}, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported subprotocols: %v", offered)
+}
+
+// NewCodec returns the codec for the subprotocols of a websocket, after negotiation
+func NewCodec(subprotocols []string) Codec {
+	for i, subprotocol := range Subprotocols {
+		if slices.Contains(subprotocols, subprotocol) {
+			return envelopeCodec{version: Version - i}
+		}
+	}
+	return legacyCodec{}
+}
+
+// envelopeCodec encodes envelopes as JSON, stamped with the negotiated version
+type envelopeCodec struct {
+	version int
+}
+
+func (c envelopeCodec) Marshal(env Envelope) ([]byte, error) {
+	env.Version = c.version
+	return json.Marshal(env)
+}
+
+func (c envelopeCodec) Unmarshal(data []byte) (env Envelope, err error) {
+	if err = json.Unmarshal(data, &env); err != nil {
+		return env, err
+	}
+	if env.Version < 1 || env.Version > c.version {
+		return env, fmt.Errorf("unsupported version: %d", env.Version)
+	}
+	return env, nil
+}
+
+func (c envelopeCodec) Version() int {
+	return c.version
+}
+
+// legacyCodec encodes envelopes as the bare JSON values that clients sent before envelopes existed:
+// the caller's offer request, the recipient's answer request, session descriptions, ICE candidates, where
+// an empty candidate ends gathering, and control messages.
+type legacyCodec struct{}
+
+func (legacyCodec) Version() int {
+	return 0
+}
+
+// the legacy requests of the caller and the recipient
+type (
+	legacyCallRequest struct {
+		RecipientName string
+		Sd            webrtc.SessionDescription
+	}
+	legacyAnswerRequest struct {
+		CallerName string
+		Sd         webrtc.SessionDescription
+	}
+	legacyControl struct {
+		Control ControlType
+	}
+)
+
+func (legacyCodec) Marshal(env Envelope) ([]byte, error) {
+	switch env.Type {
+	case TypeOffer:
+		var offer Offer
+		if err := env.Decode(&offer); err != nil {
+			return nil, err
+		}
+		if offer.Recipient != "" {
+			return json.Marshal(legacyCallRequest{RecipientName: offer.Recipient, Sd: offer.SD})
+		}
+		return json.Marshal(offer.SD)
+	case TypeAnswer:
+		var answer Answer
+		if err := env.Decode(&answer); err != nil {
+			return nil, err
+		}
+		if answer.Caller != "" {
+			return json.Marshal(legacyAnswerRequest{CallerName: answer.Caller, Sd: answer.SD})
+		}
+		return json.Marshal(answer.SD)
+	case TypeCandidate:
+		var candidate Candidate
+		if err := env.Decode(&candidate); err != nil {
+			return nil, err
+		}
+		return json.Marshal(candidate.Candidate)
+	case TypeEndOfCandidates:
+		return json.Marshal(webrtc.ICECandidateInit{})
+	case TypeControl:
+		var control Control
+		if err := env.Decode(&control); err != nil {
+			return nil, err
+		}
+		// legacy callers read the first message after their offer as the answer, so they cannot be sent ringing
+		if control.Control == ControlRinging {
+			return nil, fmt.Errorf("%w: %s %s", ErrUnsupported, env.Type, control.Control)
+		}
+		return json.Marshal(legacyControl{Control: control.Control})
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, env.Type)
+	}
+}
+
+func (legacyCodec) Unmarshal(data []byte) (Envelope, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return Envelope{}, err
+	}
+
+	var (
+		t       Type
+		payload any
+	)
+	switch {
+	case has(fields, "Control"):
+		var control legacyControl
+		if err := json.Unmarshal(data, &control); err != nil {
+			return Envelope{}, err
+		}
+		t, payload = TypeControl, Control{Control: control.Control}
+	case has(fields, "RecipientName"):
+		var req legacyCallRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			return Envelope{}, err
+		}
+		t, payload = TypeOffer, Offer{Recipient: req.RecipientName, SD: req.Sd}
+	case has(fields, "CallerName"):
+		var req legacyAnswerRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			return Envelope{}, err
+		}
+		t, payload = TypeAnswer, Answer{Caller: req.CallerName, SD: req.Sd}
+	case has(fields, "sdp"):
+		var sd webrtc.SessionDescription
+		if err := json.Unmarshal(data, &sd); err != nil {
+			return Envelope{}, err
+		}
+		if sd.Type == webrtc.SDPTypeOffer {
+			t, payload = TypeOffer, Offer{SD: sd}
+		} else {
+			t, payload = TypeAnswer, Answer{SD: sd}
+		}
+	case has(fields, "candidate"):
+		var candidate webrtc.ICECandidateInit
+		if err := json.Unmarshal(data, &candidate); err != nil {
+			return Envelope{}, err
+		}
+		if candidate.Candidate == "" {
+			t = TypeEndOfCandidates
+		} else {
+			t, payload = TypeCandidate, Candidate{Candidate: candidate}
+		}
+	default:
+		return Envelope{}, errors.New("unknown legacy message")
+	}
+
+	env, err := NewEnvelope(t, payload)
+	env.Version = 0
+	return env, err
+}
+
+// has returns true if a JSON object has a non-null field
+func has(fields map[string]json.RawMessage, name string) bool {
+	value, exists := fields[name]
+	return exists && string(value) != "null"
+}
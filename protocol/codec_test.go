@@ -0,0 +1,92 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// TestLegacyControl checks which control messages can be sent to legacy clients, which read the first
+// message after their offer as a session description
+func TestLegacyControl(t *testing.T) {
+	tests := []struct {
+		control ControlType
+		want    string
+		err     error
+	}{
+		{control: ControlRinging, err: ErrUnsupported},
+		{control: ControlDeclined, want: `{"Control":"declined"}`},
+		{control: ControlCancelled, want: `{"Control":"cancelled"}`},
+		{control: ControlBusy, want: `{"Control":"busy"}`},
+		{control: ControlTimeout, want: `{"Control":"timeout"}`},
+	}
+
+	codec := NewCodec(nil)
+	for _, tt := range tests {
+		t.Run(string(tt.control), func(t *testing.T) {
+			env, err := NewEnvelope(TypeControl, Control{Control: tt.control})
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := codec.Marshal(env)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Marshal returned %v, want %v", err, tt.err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Marshal returned %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+// TestLegacyRoundTrip checks that the messages of a legacy call decode to the envelopes they were encoded from
+func TestLegacyRoundTrip(t *testing.T) {
+	sd := webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: "v=0"}
+	candidate := webrtc.ICECandidateInit{Candidate: "candidate:1 1 udp 1 127.0.0.1 5000 typ host"}
+
+	tests := []struct {
+		name    string
+		t       Type
+		payload any
+	}{
+		{name: "offer request", t: TypeOffer, payload: Offer{Recipient: "tim", SD: webrtc.SessionDescription{
+			Type: webrtc.SDPTypeOffer,
+			SDP:  "v=0",
+		}}},
+		{name: "answer request", t: TypeAnswer, payload: Answer{Caller: "greg", SD: sd}},
+		{name: "answer", t: TypeAnswer, payload: Answer{SD: sd}},
+		{name: "candidate", t: TypeCandidate, payload: Candidate{Candidate: candidate}},
+		{name: "end of candidates", t: TypeEndOfCandidates},
+		{name: "declined", t: TypeControl, payload: Control{Control: ControlDeclined}},
+	}
+
+	codec := NewCodec(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := NewEnvelope(tt.t, tt.payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := codec.Marshal(env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := codec.Unmarshal(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Type != tt.t || got.Version != 0 {
+				t.Fatalf("decoded %s version %d, want %s version 0", got.Type, got.Version, tt.t)
+			}
+			if tt.payload == nil {
+				return
+			}
+			want, _ := json.Marshal(tt.payload)
+			if string(got.Payload) != string(want) {
+				t.Errorf("decoded payload %s, want %s", got.Payload, want)
+			}
+		})
+	}
+}
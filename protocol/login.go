@@ -0,0 +1,10 @@
+package protocol
+
+import "strings"
+
+// ChallengeMessage is the message a client signs with its ed25519 private key to log in, in response to a
+// challenge from the server. It binds the challenge to the username, so that a signature for one user can't
+// be replayed as another. Signatures made by existing clients are verified against it, so it must not change.
+func ChallengeMessage(username, challenge string) []byte {
+	return []byte("vogo-login\x00" + strings.ToLower(username) + "\x00" + challenge)
+}
@@ -0,0 +1,139 @@
+// Package protocol defines the signaling messages exchanged between vogo clients and the vogo server
+// over websockets during a 1:1 call, where every message is an Envelope holding a typed payload, and in the
+// voice rooms of channels, where every message is a ChannelMessage. It also defines the message that clients
+// sign to log in with a key pair.
+//
+// The protocol version is negotiated as a websocket subprotocol when the websocket connects. Clients that
+// offer no subprotocol use the legacy protocol, where messages are bare JSON values told apart by their shape,
+// so that clients built before this package existed can still call and answer clients that use it.
+//
+// Since version 2, both clients keep their websocket open once the call connects, and the server relays
+// offers, answers and candidates between them until either side hangs up. An offer sent during the call restarts
+// ICE, which lets a call recover after a client's network changes. If either client negotiated an older version,
+// the server closes both websockets once signaling completes, as before.
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Version is the current version of the protocol
+const Version = 2
+
+// RelayVersion is the first version where the server relays signaling messages for the whole call
+const RelayVersion = 2
+
+// Type identifies the payload of an Envelope
+type Type string
+
+const (
+	// sent by the caller to start a call, and forwarded by the server to the recipient
+	TypeOffer Type = "offer"
+
+	// sent by the recipient, and forwarded by the server to the caller
+	TypeAnswer Type = "answer"
+
+	// an ICE candidate gathered by one client, forwarded by the server to the other
+	TypeCandidate Type = "candidate"
+
+	// sent once a client has gathered all of its ICE candidates. It has no payload.
+	TypeEndOfCandidates Type = "end-of-candidates"
+
+	// sent by the server when a request cannot be completed, before the websocket is closed
+	TypeError Type = "error"
+
+	// reports how the call is progressing, such as the recipient declining it
+	TypeControl Type = "control"
+)
+
+// Envelope is a single signaling message
+type Envelope struct {
+	Type    Type            `json:"type"`
+	Version int             `json:"version"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// NewEnvelope creates an envelope of the current version holding payload, which may be nil
+func NewEnvelope(t Type, payload any) (Envelope, error) {
+	env := Envelope{Type: t, Version: Version}
+	if payload == nil {
+		return env, nil
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return env, fmt.Errorf("error encoding %s: %w", t, err)
+	}
+	env.Payload = data
+	return env, nil
+}
+
+// Decode decodes the payload of the envelope into v, which should be a pointer to the payload type of its Type
+func (e Envelope) Decode(v any) error {
+	if len(e.Payload) == 0 {
+		return fmt.Errorf("%s has no payload", e.Type)
+	}
+	if err := json.Unmarshal(e.Payload, v); err != nil {
+		return fmt.Errorf("error decoding %s: %w", e.Type, err)
+	}
+	return nil
+}
+
+// Offer is the payload of TypeOffer
+type Offer struct {
+	// name of the user being called, set by the caller
+	Recipient string `json:"recipient,omitempty"`
+
+	SD webrtc.SessionDescription `json:"sd"`
+}
+
+// Answer is the payload of TypeAnswer
+type Answer struct {
+	// name of the user that called, set by the recipient
+	Caller string `json:"caller,omitempty"`
+
+	SD webrtc.SessionDescription `json:"sd"`
+}
+
+// Candidate is the payload of TypeCandidate
+type Candidate struct {
+	Candidate webrtc.ICECandidateInit `json:"candidate"`
+}
+
+// Error is the payload of TypeError
+type Error struct {
+	Message string `json:"message"`
+}
+
+// ControlType identifies a Control message
+type ControlType string
+
+const (
+	// sent by the server to the caller once the recipient has been notified of the call. Legacy callers are
+	// not sent it, since they take the first message after their offer to be the answer
+	ControlRinging ControlType = "ringing"
+
+	// sent by the recipient instead of an answer, and forwarded to the caller
+	ControlDeclined ControlType = "declined"
+
+	// sent by the caller if they hang up before the call is answered, and to the recipient by the server
+	// if the caller hangs up or disconnects
+	ControlCancelled ControlType = "cancelled"
+
+	// sent by the server to the caller if the recipient is already in a call
+	ControlBusy ControlType = "busy"
+
+	// sent by the server if the recipient did not answer in time
+	ControlTimeout ControlType = "timeout"
+
+	// sent by either client to end a call that has connected, and by the server to the other client
+	// if one hangs up or disconnects. Only sent when both clients negotiated RelayVersion or later.
+	ControlHangup ControlType = "hangup"
+)
+
+// Control is the payload of TypeControl
+type Control struct {
+	Control ControlType `json:"control"`
+}
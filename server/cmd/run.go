@@ -1,7 +1,12 @@
 package cmd
 
 import (
+	"fmt"
+	"net"
+
 	server "github.com/gregriff/vogo/server/internal"
+	"github.com/gregriff/vogo/server/internal/relay"
+	"github.com/gregriff/vogo/server/internal/schemas"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	// _ "net/http/pprof".
@@ -14,6 +19,30 @@ var runCmd = &cobra.Command{
 	Args:  cobra.MaximumNArgs(0),
 	PreRunE: func(_ *cobra.Command, args []string) error {
 		// TODO: prerun validation here
+		for _, key := range []string{"calls.ring_timeout", "calls.answer_timeout", "calls.sweep_interval"} {
+			if viper.GetDuration(key) <= 0 {
+				return fmt.Errorf("%s must be a positive duration, like \"30s\"", key)
+			}
+		}
+		for _, key := range []string{"sessions.token_ttl", "sessions.refresh_ttl"} {
+			if viper.GetDuration(key) <= 0 {
+				return fmt.Errorf("%s must be a positive duration, like \"1h\"", key)
+			}
+		}
+		if viper.GetBool("turn.enabled") {
+			if net.ParseIP(viper.GetString("turn.public_ip")) == nil {
+				return fmt.Errorf("turn.public_ip must be the ip address clients reach the relay at")
+			}
+			if viper.GetString("turn.secret") == "" {
+				return fmt.Errorf("turn.secret must be set to issue relay credentials")
+			}
+			if viper.GetDuration("turn.credential_ttl") <= 0 {
+				return fmt.Errorf("turn.credential_ttl must be a positive duration, like \"12h\"")
+			}
+			if _, err := relay.ParsePeers(viper.GetStringSlice("turn.allowed_peers")); err != nil {
+				return fmt.Errorf("turn.allowed_peers must be networks like \"10.0.0.0/8\": %w", err)
+			}
+		}
 		return nil
 	},
 	Run: runServer,
@@ -28,5 +57,33 @@ func runServer(_ *cobra.Command, _ []string) {
 		viper.GetString("server.host"),
 		viper.GetInt("server.port")
 
-	server.CreateAndListen(debug, host, port)
+	// validated by PreRunE
+	allowedPeers, _ := relay.ParsePeers(viper.GetStringSlice("turn.allowed_peers"))
+
+	timeouts := schemas.CallTimeouts{
+		Ring:   viper.GetDuration("calls.ring_timeout"),
+		Answer: viper.GetDuration("calls.answer_timeout"),
+		Sweep:  viper.GetDuration("calls.sweep_interval"),
+	}
+
+	ice := relay.Config{
+		STUNURLs:      viper.GetStringSlice("ice.stun_urls"),
+		STUNEnabled:   viper.GetBool("stun.enabled"),
+		STUNHost:      viper.GetString("stun.host"),
+		STUNPort:      viper.GetInt("stun.port"),
+		Enabled:       viper.GetBool("turn.enabled"),
+		PublicIP:      viper.GetString("turn.public_ip"),
+		Port:          viper.GetInt("turn.port"),
+		Realm:         viper.GetString("turn.realm"),
+		AllowedPeers:  allowedPeers,
+		Secret:        viper.GetString("turn.secret"),
+		CredentialTTL: viper.GetDuration("turn.credential_ttl"),
+	}
+
+	sessions := schemas.SessionTTLs{
+		Token:   viper.GetDuration("sessions.token_ttl"),
+		Refresh: viper.GetDuration("sessions.refresh_ttl"),
+	}
+
+	server.CreateAndListen(debug, host, port, timeouts, ice, sessions)
 }
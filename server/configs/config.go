@@ -33,6 +33,18 @@ func InitConfig(file string) {
 	viper.AutomaticEnv()
 	viper.SetConfigFile(file)
 
+	// config files written before these settings existed
+	viper.SetDefault("calls.ring_timeout", "30s")
+	viper.SetDefault("calls.answer_timeout", "15s")
+	viper.SetDefault("calls.sweep_interval", "5s")
+	viper.SetDefault("ice.stun_urls", []string{"stun:stun.l.google.com:19302"})
+	viper.SetDefault("sessions.token_ttl", "1h")
+	viper.SetDefault("sessions.refresh_ttl", "720h")
+	viper.SetDefault("stun.port", 3478)
+	viper.SetDefault("turn.port", 3478)
+	viper.SetDefault("turn.realm", "vogo")
+	viper.SetDefault("turn.credential_ttl", "12h")
+
 	// if config file does not exist, create it with the embedded default config
 	if _, err := os.Stat(file); err != nil {
 		log.Printf("config file not found (%s)", file)
@@ -0,0 +1,103 @@
+package crypto
+
+import (
+	"container/list"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxChallenges bounds the challenges stored at once, since anyone can request them.
+	// Once reached, the oldest challenge is dropped for each new one.
+	maxChallenges = 10_000
+
+	// maxUserChallenges bounds the challenges stored for each username, so that requests for one username
+	// can't drop the challenges of others. A new challenge drops the user's oldest.
+	maxUserChallenges = 3
+)
+
+// Challenges stores the login challenges issued to clients that authenticate with a key pair.
+// Each challenge may be used once, by the user it was issued to, until it expires.
+type Challenges struct {
+	mu  sync.Mutex
+	ttl time.Duration
+
+	// every challenge expires after ttl, so issue order is also expiry order
+	order  *list.List // of *issuedChallenge, oldest first
+	issued map[string]*list.Element
+	byUser map[string][]*list.Element
+}
+
+type issuedChallenge struct {
+	challenge,
+	username string
+	expires time.Time
+}
+
+// NewChallenges creates a store of challenges that expire after ttl
+func NewChallenges(ttl time.Duration) *Challenges {
+	return &Challenges{
+		ttl:    ttl,
+		order:  list.New(),
+		issued: make(map[string]*list.Element),
+		byUser: make(map[string][]*list.Element),
+	}
+}
+
+// Issue creates a challenge for a user to sign
+func (c *Challenges) Issue(username string) (string, error) {
+	challenge, err := GenerateToken()
+	if err != nil {
+		return "", err
+	}
+	username = strings.ToLower(username)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for e := c.order.Front(); e != nil && now.After(e.Value.(*issuedChallenge).expires); e = c.order.Front() {
+		c.removeLocked(e)
+	}
+	if issued := c.byUser[username]; len(issued) >= maxUserChallenges {
+		c.removeLocked(issued[0])
+	}
+	if c.order.Len() >= maxChallenges {
+		c.removeLocked(c.order.Front())
+	}
+
+	e := c.order.PushBack(&issuedChallenge{challenge: challenge, username: username, expires: now.Add(c.ttl)})
+	c.issued[challenge] = e
+	c.byUser[username] = append(c.byUser[username], e)
+	return challenge, nil
+}
+
+// Consume removes a challenge, returning true if it was issued to the user and hasn't expired
+func (c *Challenges) Consume(username, challenge string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, exists := c.issued[challenge]
+	if !exists {
+		return false
+	}
+	c.removeLocked(e)
+	ch := e.Value.(*issuedChallenge)
+	return ch.username == strings.ToLower(username) && time.Now().Before(ch.expires)
+}
+
+// removeLocked removes an issued challenge. c.mu must be held.
+func (c *Challenges) removeLocked(e *list.Element) {
+	ch := c.order.Remove(e).(*issuedChallenge)
+	delete(c.issued, ch.challenge)
+	issued := slices.DeleteFunc(c.byUser[ch.username], func(other *list.Element) bool {
+		return other == e
+	})
+	if len(issued) == 0 {
+		delete(c.byUser, ch.username)
+	} else {
+		c.byUser[ch.username] = issued
+	}
+}
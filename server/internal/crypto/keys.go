@@ -0,0 +1,39 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/gregriff/vogo/protocol"
+)
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// ParsePublicKey decodes an ed25519 public key sent by a client as standard base64
+func ParsePublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("public key is not base64: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be %d bytes", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// VerifyChallenge checks a base64 signature of protocol.ChallengeMessage made with the private key of publicKey
+func VerifyChallenge(publicKey []byte, username, challenge, signature string) error {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return errors.New("user has no public key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("signature is not base64: %w", err)
+	}
+	if !ed25519.Verify(publicKey, protocol.ChallengeMessage(username, challenge), sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// tokenBytes is the length of a session token before encoding
+const tokenBytes = 32
+
+// GenerateToken creates an opaque session token. Only its hash, from HashToken, should be stored.
+func GenerateToken() (string, error) {
+	token := make([]byte, tokenBytes)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// HashToken hashes a session token for storage and lookup. Tokens are random, so unlike passwords
+// a fast hash is enough.
+func HashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
@@ -0,0 +1,82 @@
+package dal
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gregriff/vogo/server/internal/schemas"
+	"github.com/gregriff/vogo/server/internal/schemas/public"
+)
+
+// CreateCallRecord adds a call to the call history of its caller and recipient
+func CreateCallRecord(db *sql.DB, record *schemas.CallRecord) error {
+	query := `
+        INSERT INTO calls (id, caller_id, recipient_id, channel_id, outcome, started_at, ended_at, duration)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+    `
+	_, err := db.Exec(query,
+		record.Id, record.CallerId, record.RecipientId, record.ChannelId,
+		record.Outcome, record.StartedAt, record.EndedAt, record.Duration,
+	)
+	if err != nil {
+		return fmt.Errorf("error inserting call: %w", err)
+	}
+	return nil
+}
+
+// GetCalls returns a page of the call history of a user with a given id, newest first.
+// The calls include those made to the user and their visits to channel voice rooms.
+func GetCalls(db *sql.DB, userId uuid.UUID, limit, offset int) ([]public.CallRecord, error) {
+	query := `
+        SELECT caller.username, recipient.username, ch.name, c.outcome, c.started_at, c.ended_at, c.duration
+        FROM calls c
+        JOIN users caller ON c.caller_id = caller.id
+        LEFT JOIN users recipient ON c.recipient_id = recipient.id
+        LEFT JOIN channels ch ON c.channel_id = ch.id
+        WHERE c.caller_id = $1 OR c.recipient_id = $1
+        ORDER BY c.started_at DESC
+        LIMIT $2 OFFSET $3
+    `
+	return queryCalls(db, query, userId, limit, offset)
+}
+
+// GetMissedCalls returns the calls to a user with a given id that they missed since a given time, newest first
+func GetMissedCalls(db *sql.DB, userId uuid.UUID, since time.Time) ([]public.CallRecord, error) {
+	query := `
+        SELECT caller.username, recipient.username, NULL, c.outcome, c.started_at, c.ended_at, c.duration
+        FROM calls c
+        JOIN users caller ON c.caller_id = caller.id
+        JOIN users recipient ON c.recipient_id = recipient.id
+        WHERE c.recipient_id = $1 AND c.outcome = 'missed' AND c.started_at >= $2
+        ORDER BY c.started_at DESC
+    `
+	return queryCalls(db, query, userId, since)
+}
+
+// queryCalls scans the rows of a query selecting the columns of public.CallRecord
+func queryCalls(db *sql.DB, query string, args ...any) ([]public.CallRecord, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying calls: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	calls := make([]public.CallRecord, 0, 10)
+	for rows.Next() {
+		var (
+			call               public.CallRecord
+			recipient, channel sql.NullString
+		)
+		err = rows.Scan(&call.Caller, &recipient, &channel, &call.Outcome, &call.StartedAt, &call.EndedAt, &call.Duration)
+		if err != nil {
+			return nil, err
+		}
+		call.Recipient, call.Channel = recipient.String, channel.String
+		calls = append(calls, call)
+	}
+	return calls, rows.Err()
+}
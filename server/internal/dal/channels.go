@@ -0,0 +1,50 @@
+package dal
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/gregriff/vogo/server/internal/schemas"
+)
+
+// GetMemberChannel returns a channel with a given name that the user with a given id is a member of.
+// Channel names are only unique per owner, so an error is returned if the name is ambiguous.
+func GetMemberChannel(db *sql.DB, userId uuid.UUID, name string) (*schemas.Channel, error) {
+	query := `
+        SELECT c.id, owner_user.username, c.name, c.description, c.capacity, c.mode, c.created_at
+        FROM channels c
+        JOIN users owner_user ON c.owner_id = owner_user.id
+        JOIN channel_members m ON c.id = m.channel_id
+        WHERE m.user_id = $1 AND c.name = $2
+    `
+	rows, err := db.Query(query, userId, name)
+	if err != nil {
+		return nil, fmt.Errorf("error querying channel: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var channels []schemas.Channel
+	for rows.Next() {
+		var ch schemas.Channel
+		err = rows.Scan(&ch.Id, &ch.Owner, &ch.Name, &ch.Description, &ch.Capacity, &ch.Mode, &ch.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, ch)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	switch len(channels) {
+	case 0:
+		return nil, fmt.Errorf("channel not found: %s", name)
+	case 1:
+		return &channels[0], nil
+	default:
+		return nil, fmt.Errorf("member of multiple channels named %s", name)
+	}
+}
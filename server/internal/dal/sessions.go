@@ -0,0 +1,159 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/gregriff/vogo/server/internal/schemas"
+	"github.com/gregriff/vogo/server/internal/schemas/public"
+)
+
+var ErrSessionNotFound = errors.New("session not found, expired or revoked")
+
+// CreateSession adds a session for a user with a given id, storing the hashes of its tokens
+// along with the device and ip address the client logged in from
+func CreateSession(
+	db *sql.DB,
+	userId uuid.UUID,
+	device, ip string,
+	tokenHash, refreshHash []byte,
+	ttls schemas.SessionTTLs,
+) error {
+	query := `
+        INSERT INTO sessions (id, user_id, device, ip, token_hash, refresh_hash, expires_at, refresh_expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP + $7 * interval '1 second', CURRENT_TIMESTAMP + $8 * interval '1 second')
+    `
+	_, err := db.Exec(
+		query, uuid.New(), userId, device, ip, tokenHash, refreshHash, ttls.Token.Seconds(), ttls.Refresh.Seconds(),
+	)
+	if err != nil {
+		return fmt.Errorf("error inserting session: %w", err)
+	}
+	return nil
+}
+
+// GetSessionUser returns the user of the session with a given token hash, and the id of the session,
+// if the token has not expired and the session has not been revoked
+func GetSessionUser(db *sql.DB, tokenHash []byte) (user *schemas.User, sessionId uuid.UUID, err error) {
+	query := `
+        SELECT s.id, u.id, u.username, u.created_at
+        FROM sessions s
+        JOIN users u ON s.user_id = u.id
+        WHERE s.token_hash = $1 AND s.revoked_at IS NULL AND s.expires_at > CURRENT_TIMESTAMP
+    `
+	user = &schemas.User{}
+	err = db.QueryRow(query, tokenHash).Scan(&sessionId, &user.Id, &user.Name, &user.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, sessionId, ErrSessionNotFound
+		}
+		return nil, sessionId, fmt.Errorf("error querying session: %w", err)
+	}
+	return user, sessionId, nil
+}
+
+// RefreshSession replaces both tokens of the session with a given refresh token hash, renewing their expiry.
+// The old tokens stop working. The session is marked as used from ip. It returns the user of the session.
+func RefreshSession(
+	db *sql.DB,
+	refreshHash, newTokenHash, newRefreshHash []byte,
+	ip string,
+	ttls schemas.SessionTTLs,
+) (*schemas.User, error) {
+	query := `
+        UPDATE sessions
+        SET token_hash = $2, refresh_hash = $3, ip = $6, last_used_at = CURRENT_TIMESTAMP,
+            expires_at = CURRENT_TIMESTAMP + $4 * interval '1 second',
+            refresh_expires_at = CURRENT_TIMESTAMP + $5 * interval '1 second'
+        FROM users u
+        WHERE sessions.user_id = u.id
+          AND sessions.refresh_hash = $1
+          AND sessions.revoked_at IS NULL
+          AND sessions.refresh_expires_at > CURRENT_TIMESTAMP
+        RETURNING u.id, u.username, u.created_at
+    `
+	var user schemas.User
+	err := db.QueryRow(query, refreshHash, newTokenHash, newRefreshHash, ttls.Token.Seconds(), ttls.Refresh.Seconds(), ip).
+		Scan(&user.Id, &user.Name, &user.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("error refreshing session: %w", err)
+	}
+	return &user, nil
+}
+
+// RevokeSession revokes the session with a given id, so that neither of its tokens work
+func RevokeSession(db *sql.DB, sessionId uuid.UUID) error {
+	_, err := db.Exec("UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL", sessionId)
+	if err != nil {
+		return fmt.Errorf("error revoking session: %w", err)
+	}
+	return nil
+}
+
+// RevokeUserSession revokes a session with a given id if it belongs to the user with a given id.
+// ErrSessionNotFound is returned if the user has no such active session.
+func RevokeUserSession(db *sql.DB, userId, sessionId uuid.UUID) error {
+	query := `
+        UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP
+        WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND refresh_expires_at > CURRENT_TIMESTAMP
+    `
+	result, err := db.Exec(query, sessionId, userId)
+	if err != nil {
+		return fmt.Errorf("error revoking session: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// TouchSession marks the session with a given id as used from ip. To avoid a write on every request,
+// the session is only updated if the ip changed or it was last marked over a minute ago.
+func TouchSession(db *sql.DB, sessionId uuid.UUID, ip string) error {
+	query := `
+        UPDATE sessions SET last_used_at = CURRENT_TIMESTAMP, ip = $2
+        WHERE id = $1
+          AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - interval '1 minute' OR ip IS DISTINCT FROM $2)
+    `
+	if _, err := db.Exec(query, sessionId, ip); err != nil {
+		return fmt.Errorf("error updating session: %w", err)
+	}
+	return nil
+}
+
+// GetSessions returns the sessions of a user with a given id that can still be used or refreshed,
+// most recently used first
+func GetSessions(db *sql.DB, userId uuid.UUID) ([]public.Session, error) {
+	query := `
+        SELECT id, COALESCE(device, ''), COALESCE(ip, ''), created_at, COALESCE(last_used_at, created_at)
+        FROM sessions
+        WHERE user_id = $1 AND revoked_at IS NULL AND refresh_expires_at > CURRENT_TIMESTAMP
+        ORDER BY last_used_at DESC NULLS LAST
+    `
+	rows, err := db.Query(query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error querying sessions: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	sessions := make([]public.Session, 0, 5)
+	for rows.Next() {
+		var (
+			session public.Session
+			id      uuid.UUID
+		)
+		if err = rows.Scan(&id, &session.Device, &session.IP, &session.CreatedAt, &session.LastUsedAt); err != nil {
+			return nil, err
+		}
+		session.Id = id.String()
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
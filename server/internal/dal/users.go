@@ -15,7 +15,8 @@ import (
 )
 
 // CreateUser adds a user to the database and associates them with their invite code.
-func CreateUser(db *sql.DB, username, hashedPassword, inviteCode string) (*string, error) {
+// hashedPassword may be empty and publicKey may be nil, but not both.
+func CreateUser(db *sql.DB, username, hashedPassword string, publicKey []byte, inviteCode string) (*string, error) {
 	userId := uuid.New()
 	username = strings.ToLower(username)
 
@@ -27,10 +28,11 @@ func CreateUser(db *sql.DB, username, hashedPassword, inviteCode string) (*strin
 
 	var dbUsername string
 	err := tx.QueryRow(
-		"INSERT INTO users (id, username, password) VALUES ($1, $2, $3) RETURNING username",
+		"INSERT INTO users (id, username, password, public_key) VALUES ($1, $2, $3, $4) RETURNING username",
 		userId,
 		username,
-		hashedPassword,
+		sql.NullString{String: hashedPassword, Valid: hashedPassword != ""},
+		publicKey,
 	).Scan(&dbUsername)
 	if err != nil {
 		return nil, fmt.Errorf("error inserting user: %w", err)
@@ -71,13 +73,13 @@ func GetUser(db *sql.DB, username string) (*schemas.User, error) {
 	return &user, nil
 }
 
-// GetUserWithPassword returns a friend from the database with their hashed password given their username.
+// GetUserWithPassword returns a friend from the database with their hashed password and public key given their username.
 func GetUserWithPassword(db *sql.DB, username string) (*schemas.UserWithPassword, error) {
 	var user schemas.UserWithPassword
 	username = strings.ToLower(username)
 
-	query := "SELECT id, username, password, created_at FROM users WHERE username = $1"
-	err := db.QueryRow(query, username).Scan(&user.Id, &user.Name, &user.Password, &user.CreatedAt)
+	query := "SELECT id, username, COALESCE(password, ''), public_key, created_at FROM users WHERE username = $1"
+	err := db.QueryRow(query, username).Scan(&user.Id, &user.Name, &user.Password, &user.PublicKey, &user.CreatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("user not found: %s", username)
@@ -146,14 +148,14 @@ func GetChannels(db *sql.DB, userId string) ([]public.Channel, error) {
 	query := `
         SELECT
             c.id, owner_user.username as owner_name, c.name, c.description,
-            c.capacity, ARRAY_AGG(u.username) as member_names
+            c.capacity, c.mode, ARRAY_AGG(u.username) as member_names
         FROM channels c
         JOIN users owner_user ON c.owner_id = owner_user.id
         JOIN channel_members cm_user ON c.id = cm_user.channel_id
         JOIN channel_members m ON c.id = m.channel_id
         JOIN users u ON m.user_id = u.id
         WHERE cm_user.user_id = $1
-        GROUP BY c.id, owner_user.username, c.name, c.description, c.capacity
+        GROUP BY c.id, owner_user.username, c.name, c.description, c.capacity, c.mode
     `
 
 	rows, err := db.Query(query, userId)
@@ -169,7 +171,7 @@ func GetChannels(db *sql.DB, userId string) ([]public.Channel, error) {
 		var ch public.Channel
 		err = rows.Scan(
 			&tmpId, &ch.Owner, &ch.Name, &ch.Description,
-			&ch.Capacity, &ch.MemberNames,
+			&ch.Capacity, &ch.Mode, &ch.MemberNames,
 		)
 		if err != nil {
 			return nil, err
@@ -180,13 +182,12 @@ func GetChannels(db *sql.DB, userId string) ([]public.Channel, error) {
 	return channels, rows.Err()
 }
 
-// AddFriend adds a friend with a given name.
-func AddFriend(db *sql.DB, userId uuid.UUID, friendName string) (*public.User, error) {
-	friend := public.User{}
-
-	dbFriend, err := GetUser(db, friendName)
+// AddFriend adds a friend with a given name. The returned status of the friendship is "pending" if a request
+// was sent, "accepted" if a pending request was accepted, or empty if the friendship was unchanged.
+func AddFriend(db *sql.DB, userId uuid.UUID, friendName string) (friend *schemas.User, status string, err error) {
+	friend, err = GetUser(db, friendName)
 	if err != nil {
-		return &friend, fmt.Errorf("friend not found: %w", err)
+		return nil, "", fmt.Errorf("friend not found: %w", err)
 	}
 
 	// if the request is already pending, update it to accepted
@@ -196,13 +197,42 @@ func AddFriend(db *sql.DB, userId uuid.UUID, friendName string) (*public.User, e
 		ON CONFLICT (user_one, user_two)
 		DO UPDATE SET status = 'accepted'
     	WHERE friendships.status = 'pending'
+		RETURNING status
        `
-	_, err = db.Exec(query, userId, dbFriend.Id)
+	err = db.QueryRow(query, userId, friend.Id).Scan(&status)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, "", fmt.Errorf("error during add friend query: %w", err)
+	}
+	// no rows means the friendship already existed, so nothing changed
+	return friend, status, nil
+}
+
+// GetFriendIds returns the ids of a user's accepted friends
+func GetFriendIds(db *sql.DB, userId uuid.UUID) ([]uuid.UUID, error) {
+	query := `
+		SELECT CASE WHEN user_one = $1 THEN user_two ELSE user_one END
+		FROM friendships
+		WHERE (user_one = $1 OR user_two = $1)
+		AND status = 'accepted'
+		AND whos_blocked IS NULL
+	`
+	rows, err := db.Query(query, userId)
 	if err != nil {
-		return nil, fmt.Errorf("error during add friend query: %w", err)
+		return nil, fmt.Errorf("error querying friends: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
 	}
-	friend.Name = dbFriend.Name
-	return &friend, nil
+	return ids, rows.Err()
 }
 
 // AreFriends returns true if the two users are friends.
@@ -236,12 +266,12 @@ func CreateChannel(db *sql.DB, ownerId uuid.UUID, data schemas.CreateChannelRequ
 	defer tx.Rollback()
 
 	query := `
-		INSERT INTO channels (id, owner_id, name, description, capacity)
-		VALUES ($1, $2, $3, $4, $5)
-		ON CONFLICT DO NOTHING RETURNING id, name, description, capacity
+		INSERT INTO channels (id, owner_id, name, description, capacity, mode)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT DO NOTHING RETURNING id, name, description, capacity, mode
 	`
-	err := tx.QueryRow(query, uuid.New(), ownerId, data.Name, data.Description, data.Capacity).
-		Scan(&channelId, &channel.Name, &channel.Description, &channel.Capacity)
+	err := tx.QueryRow(query, uuid.New(), ownerId, data.Name, data.Description, data.Capacity, data.Mode).
+		Scan(&channelId, &channel.Name, &channel.Description, &channel.Capacity, &channel.Mode)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("channel already exists")
@@ -265,12 +295,10 @@ func CreateChannel(db *sql.DB, ownerId uuid.UUID, data schemas.CreateChannelRequ
 }
 
 // InviteFriend adds a friend to an existing channel. Only the owner can invite.
-func InviteFriend(db *sql.DB, userId uuid.UUID, channelName, friendName string) (*public.User, error) {
-	friend := public.User{}
-
-	dbFriend, err := GetUser(db, friendName)
+func InviteFriend(db *sql.DB, userId uuid.UUID, channelName, friendName string) (*schemas.User, error) {
+	friend, err := GetUser(db, friendName)
 	if err != nil {
-		return &friend, fmt.Errorf("friend not found: %w", err)
+		return nil, fmt.Errorf("friend not found: %w", err)
 	}
 
 	query := `
@@ -286,7 +314,7 @@ func InviteFriend(db *sql.DB, userId uuid.UUID, channelName, friendName string)
     `
 
 	var channelId uuid.UUID
-	err = db.QueryRow(query, channelName, userId, dbFriend.Id).Scan(&channelId)
+	err = db.QueryRow(query, channelName, userId, friend.Id).Scan(&channelId)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errors.New("channel not found or inviter is not owner")
@@ -294,6 +322,5 @@ func InviteFriend(db *sql.DB, userId uuid.UUID, channelName, friendName string)
 		log.Printf("%v", fmt.Errorf("error during invite friend query: %w", err))
 		return nil, errors.New("error during invite friend query: user probably already in channel")
 	}
-	friend.Name = dbFriend.Name
-	return &friend, nil
+	return friend, nil
 }
@@ -23,7 +23,7 @@ var (
 // GetDB opens the database once, creating it if needed.
 func GetDB() *sql.DB {
 	dbCreate.Do(func() {
-		db, dbErr = createDB()
+		db, dbErr = Open()
 		if dbErr != nil {
 			log.Fatalf("error getting db: %v", dbErr)
 		}
@@ -31,9 +31,20 @@ func GetDB() *sql.DB {
 	return db
 }
 
-// createDB opens the sqlite database, creating it if needed.
-func createDB() (*sql.DB, error) {
-	db, err := sql.Open("pgx", "") // use config file or PG env vars to set db url
+// Open opens the postgres database set by the PG environment variables, creating its tables if needed.
+// Most callers should use GetDB, which opens the database only once.
+func Open() (*sql.DB, error) {
+	return OpenDatabase("")
+}
+
+// OpenDatabase opens the database called name on the postgres server set by the PG environment variables,
+// creating its tables if needed. An empty name opens the database set by PGDATABASE.
+func OpenDatabase(name string) (*sql.DB, error) {
+	var dsn string // use config file or PG env vars to set db url
+	if name != "" {
+		dsn = "dbname=" + name
+	}
+	db, err := sql.Open("pgx", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("error opening db: %w", err)
 	}
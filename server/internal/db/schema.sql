@@ -2,7 +2,7 @@
 CREATE TABLE IF NOT EXISTS users (
   id UUID PRIMARY KEY,
   username VARCHAR(16) NOT NULL UNIQUE CHECK (length(username) > 1),
-  password VARCHAR(60) NOT NULL,
+  password VARCHAR(60),
   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -15,6 +15,29 @@ BEGIN
     IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'blocked_status') THEN
         CREATE TYPE blocked_status AS ENUM ('user_one', 'user_two', 'both');
     END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'channel_mode') THEN
+        CREATE TYPE channel_mode AS ENUM ('mesh', 'sfu', 'mcu');
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'call_outcome') THEN
+        CREATE TYPE call_outcome AS ENUM ('answered', 'missed', 'declined', 'failed');
+    END IF;
+END
+$$;
+
+ALTER TYPE channel_mode ADD VALUE IF NOT EXISTS 'mcu';
+
+-- users log in with a password, an ed25519 public key (raw 32 bytes), or both
+ALTER TABLE users ALTER COLUMN password DROP NOT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS public_key BYTEA UNIQUE;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'users_credentials_check') THEN
+        ALTER TABLE users ADD CONSTRAINT users_credentials_check
+            CHECK (password IS NOT NULL OR public_key IS NOT NULL);
+    END IF;
 END
 $$;
 
@@ -50,14 +73,34 @@ CREATE TABLE IF NOT EXISTS channels (
   owner_id UUID NOT NULL,
   name VARCHAR(20) NOT NULL,
   description VARCHAR(100),
-  capacity INTEGER DEFAULT 6 CHECK (capacity BETWEEN 1 AND 10),
+  capacity INTEGER DEFAULT 6,
+  mode channel_mode NOT NULL DEFAULT 'mesh', -- how the audio of the channel's voice room is routed between its members
   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
   FOREIGN KEY (owner_id) REFERENCES users (id) ON DELETE CASCADE,
-  UNIQUE (owner_id, name)
+  UNIQUE (owner_id, name),
+  -- every member of a mesh uploads their audio once per other member, forwarding modes only once
+  CONSTRAINT channels_capacity_check CHECK (capacity BETWEEN 1 AND CASE WHEN mode = 'mesh' THEN 10 ELSE 50 END)
 );
 
 CREATE INDEX IF NOT EXISTS idx_channels_owner ON channels (owner_id);
 
+-- channels created before channels had modes, whose capacity check is the same for every mode
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS mode channel_mode NOT NULL DEFAULT 'mesh';
+
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM pg_constraint
+        WHERE conrelid = 'channels'::regclass AND conname = 'channels_capacity_check'
+            AND pg_get_constraintdef(oid) NOT LIKE '%mode%'
+    ) THEN
+        ALTER TABLE channels DROP CONSTRAINT channels_capacity_check;
+        ALTER TABLE channels ADD CONSTRAINT channels_capacity_check
+            CHECK (capacity BETWEEN 1 AND CASE WHEN mode = 'mesh' THEN 10 ELSE 50 END);
+    END IF;
+END
+$$;
+
 CREATE TABLE IF NOT EXISTS channel_members (
   channel_id UUID NOT NULL,
   user_id UUID NOT NULL,
@@ -71,3 +114,43 @@ CREATE TABLE IF NOT EXISTS channel_members (
 
 CREATE INDEX IF NOT EXISTS idx_channel_members_user ON channel_members (user_id);
 CREATE INDEX IF NOT EXISTS idx_channel_members_channel ON channel_members (channel_id);
+
+-- a 1:1 call has a recipient, and joining a channel's voice room has a channel
+CREATE TABLE IF NOT EXISTS calls (
+  id UUID PRIMARY KEY,
+  caller_id UUID NOT NULL,
+  recipient_id UUID,
+  channel_id UUID,
+  outcome call_outcome NOT NULL,
+  started_at TIMESTAMP NOT NULL,
+  -- the server only sees a 1:1 call end if it relays the call's signaling, so other calls have no end or duration
+  ended_at TIMESTAMP,
+  duration INTEGER, -- seconds from when the call was answered until it ended
+  FOREIGN KEY (caller_id) REFERENCES users (id) ON DELETE CASCADE,
+  FOREIGN KEY (recipient_id) REFERENCES users (id) ON DELETE CASCADE,
+  FOREIGN KEY (channel_id) REFERENCES channels (id) ON DELETE CASCADE,
+  CHECK ((recipient_id IS NULL) <> (channel_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_calls_caller_started ON calls (caller_id, started_at);
+CREATE INDEX IF NOT EXISTS idx_calls_recipient_started ON calls (recipient_id, started_at);
+
+-- a logged in client. tokens are stored as sha256 hashes
+CREATE TABLE IF NOT EXISTS sessions (
+  id UUID PRIMARY KEY,
+  user_id UUID NOT NULL,
+  token_hash BYTEA NOT NULL UNIQUE,
+  refresh_hash BYTEA NOT NULL UNIQUE,
+  expires_at TIMESTAMP NOT NULL,
+  refresh_expires_at TIMESTAMP NOT NULL,
+  revoked_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions (user_id);
+
+-- shown to the user when listing their sessions
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS device VARCHAR(64);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS ip VARCHAR(45);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
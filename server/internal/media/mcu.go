@@ -0,0 +1,287 @@
+//go:build mcu
+
+package media
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gregriff/vogo/protocol"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"gopkg.in/hraban/opus.v2"
+)
+
+// the audio format of vogo clients (audio.SampleRate, audio.NumChannels and frameDuration in the cli),
+// which the mixer decodes to and encodes from
+const (
+	sampleRate      = 48_000
+	numChannels     = 2
+	frameDuration   = 20 * time.Millisecond
+	frameDurationMs = 20
+
+	// frameSize is the number of samples per frame, across both channels
+	frameSize = numChannels * frameDurationMs * (sampleRate / 1000)
+
+	// the largest possible Opus packet
+	maxOpusPacketSize = 1275
+
+	// number of decoded frames held per participant. If the mixer falls behind a participant's clock
+	// the oldest frames are dropped, bounding the latency they add.
+	mcuFrameBuffer = 3
+)
+
+// mcuEnabled is set in builds with the mcu tag, which link libopus to mix audio
+const mcuEnabled = true
+
+// mcu is a multipoint control unit for a channel's room. The server decodes every participant's Opus track,
+// mixes the decoded audio every frameDuration, and sends each participant a single track holding the mix of
+// every other participant (N-1 mixing). A participant recieves one stream no matter how many others are in the room.
+type mcu struct {
+	id uuid.UUID
+
+	mu           sync.Mutex
+	closed       bool
+	participants map[string]*mcuParticipant
+
+	// closed when the last participant leaves, stopping the mixer
+	stop chan struct{}
+}
+
+type mcuParticipant struct {
+	*peer
+	mcu *mcu
+
+	// the mix sent to the participant, encoded with its own encoder since every participant's mix differs
+	track   *webrtc.TrackLocalStaticSample
+	encoder *opus.Encoder
+
+	// decoded frames of the participant's audio, waiting to be mixed
+	frames chan []int16
+
+	// only used by the mixer: the participant's frame in the current mix, and buffers for their mix
+	frame      []int16
+	mixed      []int16
+	opusBuffer []byte
+}
+
+var (
+	mcus   = make(map[uuid.UUID]*mcu, 10)
+	mcusMu sync.Mutex
+)
+
+// joinMCU adds a participant to the MCU of a channel, creating the MCU if needed
+func joinMCU(channelId uuid.UUID, name string, outbox chan<- protocol.ChannelMessage) (Participant, error) {
+	for {
+		participant, err := getMCU(channelId).join(name, outbox)
+		if errors.Is(err, errRoomClosed) {
+			continue // the last participant left while we were joining
+		}
+		if err != nil {
+			return nil, err
+		}
+		return participant, nil
+	}
+}
+
+func getMCU(channelId uuid.UUID) *mcu {
+	mcusMu.Lock()
+	defer mcusMu.Unlock()
+
+	m, exists := mcus[channelId]
+	if !exists {
+		m = &mcu{
+			id:           channelId,
+			participants: make(map[string]*mcuParticipant, 10),
+			stop:         make(chan struct{}),
+		}
+		mcus[channelId] = m
+		go m.mix()
+	}
+	return m
+}
+
+// join creates the participant's PeerConnection, with a single sendrecv transceiver that uploads
+// their audio and recieves their mix, and sends them an offer
+func (m *mcu) join(name string, outbox chan<- protocol.ChannelMessage) (*mcuParticipant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, errRoomClosed
+	}
+
+	encoder, err := opus.NewEncoder(sampleRate, numChannels, opus.AppVoIP)
+	if err != nil {
+		return nil, fmt.Errorf("encoder error: %w", err)
+	}
+	track, err := webrtc.NewTrackLocalStaticSample(opusCodec, "audio-mix", "vogo")
+	if err != nil {
+		return nil, fmt.Errorf("error creating track: %w", err)
+	}
+
+	p, err := newPeer(name, outbox)
+	if err != nil {
+		return nil, err
+	}
+	participant := &mcuParticipant{
+		peer:       p,
+		mcu:        m,
+		track:      track,
+		encoder:    encoder,
+		frames:     make(chan []int16, mcuFrameBuffer),
+		mixed:      make([]int16, frameSize),
+		opusBuffer: make([]byte, maxOpusPacketSize),
+	}
+
+	sender, err := p.pc.AddTrack(track)
+	if err != nil {
+		p.close()
+		return nil, fmt.Errorf("error adding track: %w", err)
+	}
+	go readRTCP(sender)
+
+	p.pc.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		participant.decode(remote)
+	})
+	p.pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		log.Printf("mcu: connection to %s has changed: %s", name, state.String())
+	})
+
+	m.participants[name] = participant
+	if err = p.offer(); err != nil {
+		delete(m.participants, name)
+		p.close()
+		return nil, err
+	}
+	return participant, nil
+}
+
+// Close removes the participant from the MCU, stopping the mixer if they were the last one
+func (p *mcuParticipant) Close() {
+	m := p.mcu
+	m.mu.Lock()
+	if m.participants[p.name] == p {
+		delete(m.participants, p.name)
+	}
+	empty := len(m.participants) == 0
+	if empty && !m.closed {
+		m.closed = true
+		close(m.stop)
+	}
+	m.mu.Unlock()
+
+	p.close()
+
+	if empty {
+		mcusMu.Lock()
+		if mcus[m.id] == m {
+			delete(mcus, m.id)
+		}
+		mcusMu.Unlock()
+	}
+}
+
+// decode decodes every packet of the participant's track into frames for the mixer. It blocks until the track ends.
+func (p *mcuParticipant) decode(remote *webrtc.TrackRemote) {
+	decoder, err := opus.NewDecoder(sampleRate, numChannels)
+	if err != nil {
+		log.Printf("mcu: error creating decoder for %s: %v", p.name, err)
+		return
+	}
+
+	for {
+		packet, _, err := remote.ReadRTP()
+		if err != nil {
+			return
+		}
+		if len(packet.Payload) == 0 {
+			continue
+		}
+
+		frame := make([]int16, frameSize)
+		if _, err = decoder.Decode(packet.Payload, frame); err != nil {
+			log.Printf("mcu: error decoding audio from %s: %v", p.name, err)
+			continue
+		}
+
+		select {
+		case p.frames <- frame:
+		default:
+			// this is the only sender, so a frame can always be sent once the oldest is dropped
+			select {
+			case <-p.frames:
+			default:
+			}
+			p.frames <- frame
+		}
+	}
+}
+
+// mix sums one frame of every participant each frameDuration, then sends each participant the sum
+// without their own frame. Participants without a frame ready are silent in that mix.
+func (m *mcu) mix() {
+	ticker := time.NewTicker(frameDuration)
+	defer ticker.Stop()
+
+	sum := make([]int32, frameSize)
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+		}
+
+		m.mu.Lock()
+		clear(sum)
+		for _, p := range m.participants {
+			select {
+			case p.frame = <-p.frames:
+				for i, sample := range p.frame {
+					sum[i] += int32(sample)
+				}
+			default:
+				p.frame = nil
+			}
+		}
+		for _, p := range m.participants {
+			p.writeMix(sum)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// writeMix encodes the sum of every frame minus the participant's own, and writes it to their track
+func (p *mcuParticipant) writeMix(sum []int32) {
+	for i, sample := range sum {
+		if p.frame != nil {
+			sample -= int32(p.frame[i])
+		}
+		p.mixed[i] = clip(sample)
+	}
+
+	n, err := p.encoder.Encode(p.mixed, p.opusBuffer)
+	if err != nil {
+		log.Printf("mcu: error encoding mix for %s: %v", p.name, err)
+		return
+	}
+	if err = p.track.WriteSample(media.Sample{Data: p.opusBuffer[:n], Duration: frameDuration}); err != nil {
+		log.Printf("mcu: error writing mix to %s: %v", p.name, err)
+	}
+}
+
+// clip limits a mixed sample to the range of 16-bit PCM
+func clip(sample int32) int16 {
+	switch {
+	case sample > math.MaxInt16:
+		return math.MaxInt16
+	case sample < math.MinInt16:
+		return math.MinInt16
+	default:
+		return int16(sample)
+	}
+}
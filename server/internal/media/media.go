@@ -0,0 +1,73 @@
+// package media implements server-side media for channel voice rooms, where each member holds a single
+// PeerConnection to the server instead of one to every other member. The server is always the offerer,
+// and is addressed with an empty name in the room's protocol.ChannelMessage signaling.
+package media
+
+import (
+	"fmt"
+
+	"github.com/gregriff/vogo/protocol"
+	"github.com/gregriff/vogo/server/internal/schemas"
+	"github.com/gregriff/vogo/server/internal/schemas/public"
+	"github.com/pion/webrtc/v4"
+)
+
+// Participant is a member of a channel's room connected to the server by a single PeerConnection
+type Participant interface {
+	// Signal applies an answer or ICE candidate sent by the participant to the server
+	Signal(msg protocol.ChannelMessage) error
+
+	// Close removes the participant from the room and closes their PeerConnection
+	Close()
+}
+
+// Join connects a member of a channel's room to the server-side media of the room, according to the
+// channel's mode. The server's offers and ICE candidates for the member are sent to outbox.
+func Join(channel *schemas.Channel, name string, outbox chan<- protocol.ChannelMessage) (Participant, error) {
+	switch channel.Mode {
+	case public.ChannelModeSFU:
+		return joinSFU(channel.Id, name, outbox)
+	case public.ChannelModeMCU:
+		return joinMCU(channel.Id, name, outbox)
+	default:
+		return nil, fmt.Errorf("channel mode has no server-side media: %s", channel.Mode)
+	}
+}
+
+// Supports returns true if this build of the server can route the audio of rooms in a channel mode.
+// public.ChannelModeMCU is only supported by builds with the mcu tag.
+func Supports(mode string) bool {
+	return mode != public.ChannelModeMCU || mcuEnabled
+}
+
+var opusCodec = webrtc.RTPCodecCapability{
+	MimeType:  webrtc.MimeTypeOpus,
+	ClockRate: 48_000,
+	Channels:  2,
+}
+
+// newPeerConnection creates a PeerConnection to a participant configured with the Opus audio codec,
+// matching the codec of vogo clients.
+func newPeerConnection() (*webrtc.PeerConnection, error) {
+	mediaEngine := &webrtc.MediaEngine{}
+	codecParams := webrtc.RTPCodecParameters{
+		RTPCodecCapability: opusCodec,
+		PayloadType:        111,
+	}
+	if err := mediaEngine.RegisterCodec(codecParams, webrtc.RTPCodecTypeAudio); err != nil {
+		return nil, fmt.Errorf("error registering codec: %w", err)
+	}
+
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(mediaEngine))
+	return api.NewPeerConnection(webrtc.Configuration{})
+}
+
+// readRTCP drains RTCP packets for a sender until its PeerConnection is closed
+func readRTCP(sender *webrtc.RTPSender) {
+	buf := make([]byte, 1500)
+	for {
+		if _, _, err := sender.Read(buf); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !mcu
+
+package media
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/gregriff/vogo/protocol"
+)
+
+// mcuEnabled is unset in builds without the mcu tag, so that the server doesn't need cgo and libopus
+// unless it mixes audio
+const mcuEnabled = false
+
+var errNoMCU = errors.New("mcu mode is not supported by this server, which was built without the mcu tag")
+
+// joinMCU rejects every participant, since this build of the server cannot mix audio
+func joinMCU(uuid.UUID, string, chan<- protocol.ChannelMessage) (Participant, error) {
+	return nil, errNoMCU
+}
@@ -0,0 +1,160 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/gregriff/vogo/protocol"
+	"github.com/pion/webrtc/v4"
+)
+
+// peer is the server's end of a participant's PeerConnection, and handles its signaling.
+// The server sends every offer, so renegotiation is serialized here instead of being
+// resolved between two offerers.
+type peer struct {
+	name   string
+	pc     *webrtc.PeerConnection
+	outbox chan<- protocol.ChannelMessage
+
+	// messages waiting to be sent to outbox, in order. Queueing never blocks, so that offers can be sent while
+	// the locks of a room are held without one slow participant holding up the rest
+	queueMu sync.Mutex
+	queue   []protocol.ChannelMessage
+	queued  chan struct{}
+
+	// closed when the participant leaves, stopping sends to outbox
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// called to send a new offer once the previous offer is answered
+	renegotiate func() error
+
+	mu      sync.Mutex
+	pending bool
+}
+
+func newPeer(name string, outbox chan<- protocol.ChannelMessage) (*peer, error) {
+	pc, err := newPeerConnection()
+	if err != nil {
+		return nil, fmt.Errorf("error creating peer connection: %w", err)
+	}
+
+	p := &peer{
+		name:   name,
+		pc:     pc,
+		outbox: outbox,
+		queued: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	p.renegotiate = p.offer
+	go p.drain()
+	pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+		if c == nil {
+			return
+		}
+		candidate := c.ToJSON()
+		p.send(protocol.ChannelMessage{Type: protocol.ChannelCandidate, To: name, Candidate: &candidate})
+	})
+	return p, nil
+}
+
+// Signal applies an answer or ICE candidate sent by the participant
+func (p *peer) Signal(msg protocol.ChannelMessage) error {
+	switch msg.Type {
+	case protocol.ChannelAnswer:
+		if msg.Sd == nil {
+			return errors.New("empty answer")
+		}
+		p.mu.Lock()
+		err := p.pc.SetRemoteDescription(*msg.Sd)
+		pending := p.pending
+		p.pending = false
+		p.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("error setting remote description: %w", err)
+		}
+		if pending {
+			return p.renegotiate()
+		}
+	case protocol.ChannelCandidate:
+		if msg.Candidate == nil {
+			return nil
+		}
+		if err := p.pc.AddICECandidate(*msg.Candidate); err != nil {
+			return fmt.Errorf("error adding ICE candidate: %w", err)
+		}
+	default:
+		return fmt.Errorf("unexpected message for server: %s", msg.Type)
+	}
+	return nil
+}
+
+// offer creates and sends an offer to the participant. If an earlier offer is still waiting
+// on an answer, the offer is deferred until that answer arrives.
+func (p *peer) offer() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pc.SignalingState() == webrtc.SignalingStateHaveLocalOffer {
+		p.pending = true
+		return nil
+	}
+
+	offer, err := p.pc.CreateOffer(nil)
+	if err != nil {
+		return fmt.Errorf("error creating offer: %w", err)
+	}
+	if err = p.pc.SetLocalDescription(offer); err != nil {
+		return fmt.Errorf("error setting local description: %w", err)
+	}
+	p.send(protocol.ChannelMessage{Type: protocol.ChannelOffer, To: p.name, Sd: &offer})
+	return nil
+}
+
+// send queues a message for the participant's websocket without blocking
+func (p *peer) send(msg protocol.ChannelMessage) {
+	p.queueMu.Lock()
+	p.queue = append(p.queue, msg)
+	p.queueMu.Unlock()
+
+	select {
+	case p.queued <- struct{}{}:
+	default: // already signalled
+	}
+}
+
+// drain sends queued messages to outbox in order, until the participant leaves. The queue stays small,
+// since only one offer is outstanding at a time and later renegotiations are merged into one.
+func (p *peer) drain() {
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-p.queued:
+		}
+
+		p.queueMu.Lock()
+		msgs := p.queue
+		p.queue = nil
+		p.queueMu.Unlock()
+
+		for _, msg := range msgs {
+			select {
+			case <-p.done:
+				return
+			case p.outbox <- msg:
+			}
+		}
+	}
+}
+
+// close closes the PeerConnection once, returning false if it was already closed
+func (p *peer) close() (closed bool) {
+	p.closeOnce.Do(func() {
+		close(p.done)
+		_ = p.pc.Close()
+		closed = true
+	})
+	return
+}
@@ -0,0 +1,217 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/gregriff/vogo/protocol"
+	"github.com/pion/webrtc/v4"
+)
+
+// sfu is a selective forwarding unit for a channel's room. Every participant uploads their Opus track
+// to the server once, and the server forwards its RTP packets to every other participant without decoding.
+// Whenever a track is added or removed, every affected participant is sent a new offer.
+type sfu struct {
+	id uuid.UUID
+
+	mu           sync.Mutex
+	closed       bool
+	participants map[string]*sfuParticipant
+
+	// forwarded tracks, keyed by the name of the participant that sends them
+	tracks map[string]*webrtc.TrackLocalStaticRTP
+}
+
+type sfuParticipant struct {
+	*peer
+	sfu *sfu
+}
+
+var (
+	sfus   = make(map[uuid.UUID]*sfu, 10)
+	sfusMu sync.Mutex
+)
+
+var errRoomClosed = errors.New("room closed")
+
+// joinSFU adds a participant to the SFU of a channel, creating the SFU if needed
+func joinSFU(channelId uuid.UUID, name string, outbox chan<- protocol.ChannelMessage) (Participant, error) {
+	for {
+		participant, err := getSFU(channelId).join(name, outbox)
+		if errors.Is(err, errRoomClosed) {
+			continue // the last participant left while we were joining
+		}
+		if err != nil {
+			return nil, err
+		}
+		return participant, nil
+	}
+}
+
+func getSFU(channelId uuid.UUID) *sfu {
+	sfusMu.Lock()
+	defer sfusMu.Unlock()
+
+	s, exists := sfus[channelId]
+	if !exists {
+		s = &sfu{
+			id:           channelId,
+			participants: make(map[string]*sfuParticipant, 10),
+			tracks:       make(map[string]*webrtc.TrackLocalStaticRTP, 10),
+		}
+		sfus[channelId] = s
+	}
+	return s
+}
+
+// join creates the participant's PeerConnection and sends them an offer including every forwarded track
+func (s *sfu) join(name string, outbox chan<- protocol.ChannelMessage) (*sfuParticipant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, errRoomClosed
+	}
+
+	p, err := newPeer(name, outbox)
+	if err != nil {
+		return nil, err
+	}
+	participant := &sfuParticipant{peer: p, sfu: s}
+	p.renegotiate = func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.renegotiateLocked(participant)
+	}
+
+	// recieve the participant's audio
+	_, err = p.pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionRecvonly,
+	})
+	if err != nil {
+		p.close()
+		return nil, fmt.Errorf("error adding transceiver: %w", err)
+	}
+	p.pc.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		s.forward(name, remote)
+	})
+	p.pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		log.Printf("sfu: connection to %s has changed: %s", name, state.String())
+	})
+
+	s.participants[name] = participant
+	if err = s.renegotiateLocked(participant); err != nil {
+		delete(s.participants, name)
+		p.close()
+		return nil, err
+	}
+	return participant, nil
+}
+
+// Close removes the participant from the SFU. Their forwarded track is removed
+// from the other participants once its read loop stops.
+func (p *sfuParticipant) Close() {
+	s := p.sfu
+	s.mu.Lock()
+	if s.participants[p.name] == p {
+		delete(s.participants, p.name)
+	}
+	empty := len(s.participants) == 0
+	if empty {
+		s.closed = true
+	}
+	s.mu.Unlock()
+
+	p.close()
+
+	if empty {
+		sfusMu.Lock()
+		if sfus[s.id] == s {
+			delete(sfus, s.id)
+		}
+		sfusMu.Unlock()
+	}
+}
+
+// forward writes every RTP packet of a participant's track to a local track that is sent to every other
+// participant. It blocks until the participant's track ends.
+func (s *sfu) forward(owner string, remote *webrtc.TrackRemote) {
+	local, err := webrtc.NewTrackLocalStaticRTP(remote.Codec().RTPCodecCapability, "audio-"+owner, owner)
+	if err != nil {
+		log.Printf("sfu: error creating track for %s: %v", owner, err)
+		return
+	}
+
+	s.mu.Lock()
+	s.tracks[owner] = local
+	s.renegotiateAllLocked(owner)
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		if s.tracks[owner] == local {
+			delete(s.tracks, owner)
+			s.renegotiateAllLocked(owner)
+		}
+		s.mu.Unlock()
+	}()
+
+	// the local track rewrites the SSRC and payload type of each packet per recipient
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := remote.Read(buf)
+		if err != nil {
+			return
+		}
+		if _, err = local.Write(buf[:n]); err != nil {
+			log.Printf("sfu: error forwarding audio from %s: %v", owner, err)
+			return
+		}
+	}
+}
+
+// renegotiateAllLocked renegotiates with every participant except one. s.mu must be held.
+func (s *sfu) renegotiateAllLocked(except string) {
+	for name, participant := range s.participants {
+		if name == except {
+			continue
+		}
+		if err := s.renegotiateLocked(participant); err != nil {
+			log.Printf("sfu: error renegotiating with %s: %v", name, err)
+		}
+	}
+}
+
+// renegotiateLocked makes the participant's senders match the forwarded tracks of every
+// other participant, then sends them an offer. s.mu must be held.
+func (s *sfu) renegotiateLocked(p *sfuParticipant) error {
+	sending := make(map[string]bool, len(s.tracks))
+	for _, sender := range p.pc.GetSenders() {
+		track := sender.Track()
+		if track == nil {
+			continue
+		}
+		owner := track.StreamID()
+		if current, exists := s.tracks[owner]; !exists || current != track {
+			if err := p.pc.RemoveTrack(sender); err != nil {
+				return fmt.Errorf("error removing track of %s: %w", owner, err)
+			}
+			continue
+		}
+		sending[owner] = true
+	}
+
+	for owner, track := range s.tracks {
+		if owner == p.name || sending[owner] {
+			continue
+		}
+		sender, err := p.pc.AddTrack(track)
+		if err != nil {
+			return fmt.Errorf("error adding track of %s: %w", owner, err)
+		}
+		go readRTCP(sender)
+	}
+	return p.offer()
+}
@@ -5,9 +5,11 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"strings"
 
+	"github.com/google/uuid"
 	"github.com/gregriff/vogo/server/internal/crypto"
 	"github.com/gregriff/vogo/server/internal/dal"
 	"golang.org/x/net/websocket"
@@ -15,17 +17,47 @@ import (
 
 type contextKey string
 
-const authKey contextKey = "authorization"
+const (
+	authKey    contextKey = "authorization"
+	sessionKey contextKey = "session"
+)
+
+// endpoints that are used before the client has a session
+var unauthenticated = map[string]bool{
+	"/register":  true,
+	"/challenge": true,
+	"/login":     true,
+	"/refresh":   true,
+}
 
-// BasicAuth is a middleware that mandates basic auth is present in the headers and validates
-func BasicAuth(next http.Handler, db *sql.DB) http.Handler {
+// Auth is a middleware that mandates a session token is present in the headers as a bearer token, and validates it.
+// Clients from before sessions send basic auth instead, which is validated against the user's password hash.
+// This applies to websocket upgrades as well.
+func Auth(next http.Handler, db *sql.DB) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// whitelisted endpoints
-		if r.URL.Path == "/register" {
+		if unauthenticated[r.URL.Path] {
 			next.ServeHTTP(w, r)
 			return
 		}
 
+		ctx := r.Context()
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			user, sessionId, err := dal.GetSessionUser(db, crypto.HashToken(strings.TrimSpace(token)))
+			if err != nil {
+				log.Println(fmt.Errorf("auth error: %w", err))
+				writeAuthError(w)
+				return
+			}
+			if err = dal.TouchSession(db, sessionId, GetClientIP(r)); err != nil {
+				log.Println(err)
+			}
+			ctx = context.WithValue(ctx, authKey, user.Name)
+			ctx = context.WithValue(ctx, sessionKey, sessionId)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		username, password, ok := r.BasicAuth()
 		username = strings.Trim(username, " ")
 		if !ok {
@@ -40,13 +72,13 @@ func BasicAuth(next http.Handler, db *sql.DB) http.Handler {
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), authKey, username)
+		ctx = context.WithValue(ctx, authKey, username)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
 func writeAuthError(w http.ResponseWriter) {
-	w.Header().Set("WWW-Authenticate", `Basic realm="basic-client"`)
+	w.Header().Set("WWW-Authenticate", `Bearer realm="vogo"`)
 	http.Error(w, "Unauthorized", http.StatusUnauthorized)
 }
 
@@ -57,8 +89,23 @@ func GetUsername(r *http.Request) string {
 	return username
 }
 
-// GetUsernameWS gets the username from http basic auth from a request upgraded to a websocket connection.
+// GetUsernameWS gets the username of the client from a request upgraded to a websocket connection.
 func GetUsernameWS(ws *websocket.Conn) string {
 	username, _ := ws.Request().Context().Value(authKey).(string)
 	return username
 }
+
+// GetSessionId returns the id of the session that authenticated the request, if it used a session token
+func GetSessionId(r *http.Request) (uuid.UUID, bool) {
+	sessionId, ok := r.Context().Value(sessionKey).(uuid.UUID)
+	return sessionId, ok
+}
+
+// GetClientIP returns the ip address of the client that created the request
+func GetClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
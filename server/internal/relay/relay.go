@@ -0,0 +1,148 @@
+// package relay runs a STUN server that lets clients discover their public address, and a TURN server that
+// relays media between clients that cannot connect directly, such as friends behind symmetric NATs or CGNAT.
+// It also issues the list of ICE servers, and the TURN credentials, that clients connect calls with.
+package relay
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/pion/turn/v4"
+	"github.com/pion/webrtc/v4"
+)
+
+// Config configures the ICE servers given to clients, and the STUN server and TURN relay if they are enabled
+type Config struct {
+	// STUN servers given to every client
+	STUNURLs []string
+
+	// run the STUN server on STUNPort, reached by clients at STUNHost. If STUNHost is
+	// empty, clients reach it at the host they reach the vogo server at.
+	STUNEnabled bool
+	STUNHost    string
+	STUNPort    int
+
+	// run the TURN relay on Port, relaying from PublicIP, the address clients reach it at
+	Enabled  bool
+	PublicIP string
+	Port     int
+	Realm    string
+
+	// peers in these networks may be relayed to even if they are loopback, link-local or private addresses,
+	// which are otherwise rejected so that clients can't use the relay to reach the server's own network
+	AllowedPeers []netip.Prefix
+
+	// signs the short-lived credentials issued to clients, which expire after CredentialTTL
+	Secret        string
+	CredentialTTL time.Duration
+}
+
+// Listen starts the TURN relay, which accepts TURN REST credentials issued by Config.ICEServers.
+// The returned server should be closed once the vogo server stops.
+func Listen(cfg Config) (*turn.Server, error) {
+	publicIP := net.ParseIP(cfg.PublicIP)
+	if publicIP == nil {
+		return nil, fmt.Errorf("invalid public ip: %q", cfg.PublicIP)
+	}
+
+	conn, err := net.ListenPacket("udp4", net.JoinHostPort("0.0.0.0", strconv.Itoa(cfg.Port)))
+	if err != nil {
+		return nil, fmt.Errorf("error listening for turn: %w", err)
+	}
+
+	server, err := turn.NewServer(turn.ServerConfig{
+		Realm:       cfg.Realm,
+		AuthHandler: turn.LongTermTURNRESTAuthHandler(cfg.Secret, nil),
+		PacketConnConfigs: []turn.PacketConnConfig{
+			{
+				PacketConn: conn,
+				RelayAddressGenerator: &turn.RelayAddressGeneratorStatic{
+					RelayAddress: publicIP,
+					Address:      "0.0.0.0",
+				},
+				PermissionHandler: cfg.permitPeer,
+			},
+		},
+	})
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("error creating turn server: %w", err)
+	}
+	return server, nil
+}
+
+// ParsePeers parses the networks of Config.AllowedPeers from CIDR notation, like "10.0.0.0/8"
+func ParsePeers(cidrs []string) ([]netip.Prefix, error) {
+	peers := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer network: %w", err)
+		}
+		peers = append(peers, prefix.Masked())
+	}
+	return peers, nil
+}
+
+// permitPeer returns true if a client may relay media to and from a peer with a given ip. Only public unicast
+// addresses are permitted, along with the networks of AllowedPeers.
+func (c Config) permitPeer(_ net.Addr, peerIP net.IP) bool {
+	addr, ok := netip.AddrFromSlice(peerIP)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range c.AllowedPeers {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return addr.IsGlobalUnicast() && !addr.IsPrivate()
+}
+
+// STUNURL returns the URL of the STUN server for clients that reach the vogo server at a given host,
+// or an empty string if the STUN server is not enabled
+func (c Config) STUNURL(requestHost string) string {
+	if !c.STUNEnabled {
+		return ""
+	}
+	host := c.STUNHost
+	if host == "" {
+		host = requestHost
+		if h, _, err := net.SplitHostPort(requestHost); err == nil {
+			host = h
+		}
+	}
+	return "stun:" + net.JoinHostPort(host, strconv.Itoa(c.STUNPort))
+}
+
+// ICEServers returns the ICE servers for a client of a given user, which reaches the vogo server at requestHost.
+// If the relay is enabled, it includes the relay with credentials valid for CredentialTTL.
+func (c Config) ICEServers(username, requestHost string) ([]webrtc.ICEServer, error) {
+	servers := make([]webrtc.ICEServer, 0, 3)
+	if url := c.STUNURL(requestHost); url != "" {
+		servers = append(servers, webrtc.ICEServer{URLs: []string{url}})
+	}
+	if len(c.STUNURLs) > 0 {
+		servers = append(servers, webrtc.ICEServer{URLs: c.STUNURLs})
+	}
+	if !c.Enabled {
+		return servers, nil
+	}
+
+	turnUsername, credential, err := turn.GenerateLongTermTURNRESTCredentials(c.Secret, username, c.CredentialTTL)
+	if err != nil {
+		return nil, fmt.Errorf("error generating turn credentials: %w", err)
+	}
+	host := net.JoinHostPort(c.PublicIP, strconv.Itoa(c.Port))
+	servers = append(servers, webrtc.ICEServer{
+		URLs:           []string{"turn:" + host + "?transport=udp"},
+		Username:       turnUsername,
+		Credential:     credential,
+		CredentialType: webrtc.ICECredentialTypePassword,
+	})
+	return servers, nil
+}
@@ -0,0 +1,75 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/pion/stun/v3"
+)
+
+// STUNServer answers STUN binding requests, telling clients the public address their requests came from
+type STUNServer struct {
+	conn net.PacketConn
+}
+
+// ListenSTUN starts a STUN binding server on a UDP port, which clients use to discover their public address.
+// The returned server should be closed once the vogo server stops.
+func ListenSTUN(port int) (*STUNServer, error) {
+	conn, err := net.ListenPacket("udp", net.JoinHostPort("", strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("error listening for stun: %w", err)
+	}
+
+	s := &STUNServer{conn: conn}
+	go s.serve()
+	return s, nil
+}
+
+// Close stops the server
+func (s *STUNServer) Close() error {
+	return s.conn.Close()
+}
+
+// serve answers binding requests until the server is closed. Anything else is ignored.
+func (s *STUNServer) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("stun: error reading: %v", err)
+			}
+			return
+		}
+		if !stun.IsMessage(buf[:n]) {
+			continue
+		}
+
+		req := &stun.Message{Raw: append([]byte(nil), buf[:n]...)}
+		if err = req.Decode(); err != nil || req.Type != stun.BindingRequest {
+			continue
+		}
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+
+		res, err := stun.Build(
+			stun.NewTransactionIDSetter(req.TransactionID),
+			stun.BindingSuccess,
+			&stun.XORMappedAddress{IP: udpAddr.IP, Port: udpAddr.Port},
+			stun.NewSoftware("vogo-server"),
+			stun.Fingerprint,
+		)
+		if err != nil {
+			log.Printf("stun: error building response: %v", err)
+			continue
+		}
+		if _, err = s.conn.WriteTo(res.Raw, addr); err != nil {
+			log.Printf("stun: error writing to %s: %v", addr, err)
+		}
+	}
+}
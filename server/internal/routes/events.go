@@ -0,0 +1,96 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gregriff/vogo/server/internal/dal"
+	"github.com/gregriff/vogo/server/internal/middleware"
+	"github.com/gregriff/vogo/server/internal/schemas"
+	"github.com/gregriff/vogo/server/internal/schemas/public"
+	"golang.org/x/net/websocket"
+)
+
+// Events pushes events for the client, such as incoming calls, friend requests and channel invites, as they
+// happen, after first sending an incoming call event for every call already waiting on the client.
+// When a user's first client connects, their friends are sent an event that they came online.
+// The client never writes to the websocket, and Events stays open until the client closes it.
+func (h *RouteHandler) Events(ws *websocket.Conn) {
+	ctx, cancel := context.WithCancel(ws.Request().Context())
+	defer cancel()
+
+	// events are pushed long after the read timeout of the http server
+	_ = ws.SetDeadline(time.Time{})
+
+	username := middleware.GetUsernameWS(ws)
+	user, err := dal.GetUser(h.db, username)
+	if err != nil {
+		log.Println(fmt.Errorf("error fetching user: %w", err))
+		_ = ws.WriteClose(http.StatusInternalServerError)
+		return
+	}
+
+	events := schemas.GetEvents()
+	sub, first := events.Subscribe(user)
+	defer events.Unsubscribe(sub)
+
+	if first {
+		friendIds, err := dal.GetFriendIds(h.db, user.Id)
+		if err != nil {
+			log.Println(fmt.Errorf("error fetching friends: %w", err))
+		}
+		for _, id := range friendIds {
+			events.Publish(id, public.Event{Type: public.EventFriendOnline, From: user.Name})
+		}
+	}
+
+	// calls that started ringing before the client connected
+	for _, caller := range schemas.GetPendingCalls().Callers(user.Id) {
+		event := public.Event{Type: public.EventIncomingCall, From: caller, Time: time.Now()}
+		if err := websocket.JSON.Send(ws, event); err != nil {
+			log.Printf("error writing pending calls to %s: %v", user.Name, err)
+			return
+		}
+	}
+
+	// the only thing the client sends is a close frame
+	var (
+		read   sync.WaitGroup
+		closed = make(chan error, 1)
+	)
+	defer func() {
+		cancel()
+		_ = ws.Close()
+		read.Wait()
+	}()
+	read.Go(func() {
+		for {
+			if err := receiveWithContext(ctx, ws, &struct{}{}); err != nil {
+				closed <- err
+				return
+			}
+		}
+	})
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-closed:
+			if err != io.EOF {
+				log.Printf("error reading from %s: %v", user.Name, err)
+			}
+			return
+		case event := <-sub.Events:
+			if err := websocket.JSON.Send(ws, event); err != nil {
+				log.Printf("error writing %s to %s: %v", event.Type, user.Name, err)
+				return
+			}
+		}
+	}
+}
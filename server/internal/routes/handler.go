@@ -3,16 +3,34 @@ package routes
 
 import (
 	"database/sql"
+	"time"
+
+	"github.com/gregriff/vogo/server/internal/crypto"
+	"github.com/gregriff/vogo/server/internal/relay"
+	"github.com/gregriff/vogo/server/internal/schemas"
 )
 
 // RouteHandler provides the dependencies for any endpoint, and is the reciever of the endpoint handling functions
 type RouteHandler struct {
-	db *sql.DB
+	db       *sql.DB
+	timeouts schemas.CallTimeouts
+	ice      relay.Config
+	sessions schemas.SessionTTLs
+
+	// issued to clients that log in with a key pair
+	challenges *crypto.Challenges
 }
 
+// challengeTTL is how long a client has to sign a login challenge
+const challengeTTL = time.Minute
+
 // NewRouteHandler creates the reciever for all endpoint handling functions
-func NewRouteHandler(db *sql.DB) *RouteHandler {
+func NewRouteHandler(db *sql.DB, timeouts schemas.CallTimeouts, ice relay.Config, sessions schemas.SessionTTLs) *RouteHandler {
 	return &RouteHandler{
-		db: db,
+		db:         db,
+		timeouts:   timeouts,
+		ice:        ice,
+		sessions:   sessions,
+		challenges: crypto.NewChallenges(challengeTTL),
 	}
 }
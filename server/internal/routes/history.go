@@ -0,0 +1,131 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gregriff/vogo/server/internal/dal"
+	"github.com/gregriff/vogo/server/internal/middleware"
+	"github.com/gregriff/vogo/server/internal/schemas"
+	"github.com/gregriff/vogo/server/internal/schemas/public"
+)
+
+// pages of GET /calls
+const (
+	defaultCallsLimit = 20
+	maxCallsLimit     = 100
+)
+
+// missedCallsWindow is how far back GET /status looks for missed calls
+const missedCallsWindow = 24 * time.Hour
+
+// Calls returns a page of the client's call history, newest first. The page is selected with
+// the limit and offset query parameters.
+func (h *RouteHandler) Calls(w http.ResponseWriter, req *http.Request) {
+	username := middleware.GetUsername(req)
+
+	user, err := dal.GetUser(h.db, username)
+	if err != nil {
+		err = fmt.Errorf("error getting user: %w", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	limit, offset := defaultCallsLimit, 0
+	query := req.URL.Query()
+	if param := query.Get("limit"); param != "" {
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit < 1 || limit > maxCallsLimit {
+			err = fmt.Errorf("limit must be between 1 and %d", maxCallsLimit)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if param := query.Get("offset"); param != "" {
+		offset, err = strconv.Atoi(param)
+		if err != nil || offset < 0 {
+			err = errors.New("offset must not be negative")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// fetch one extra call to know if there are more
+	calls, err := dal.GetCalls(h.db, user.Id, limit+1, offset)
+	if err != nil {
+		err = fmt.Errorf("error getting calls: %w", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := public.CallsResponse{Calls: calls, More: len(calls) > limit}
+	if res.More {
+		res.Calls = calls[:limit]
+	}
+	WriteJSON(w, &res)
+}
+
+// recordCall adds a 1:1 call to the call history once it has been deleted from the pending calls,
+// given its final state
+func (h *RouteHandler) recordCall(call *schemas.Call, state schemas.CallState) {
+	var outcome string
+	switch {
+	case state == schemas.CallConnected:
+		outcome = public.CallOutcomeAnswered
+	case state == schemas.CallDeclined:
+		outcome = public.CallOutcomeDeclined
+	case call.AnsweredAt.IsZero():
+		outcome = public.CallOutcomeMissed
+	default:
+		outcome = public.CallOutcomeFailed
+	}
+
+	record := newCallRecord(call.Caller().Id, call.CreatedAt, outcome)
+	record.Id = call.Id
+	record.RecipientId = uuid.NullUUID{UUID: call.Recipient().Id, Valid: true}
+
+	// the call ended now unless it connected without being relayed, in which case the clients may still be talking
+	switch {
+	case state != schemas.CallConnected:
+		endCallRecord(record, time.Time{})
+	case call.Relayed():
+		endCallRecord(record, call.AnsweredAt)
+	}
+	if err := dal.CreateCallRecord(h.db, record); err != nil {
+		log.Println(fmt.Errorf("error recording call: %w", err))
+	}
+}
+
+// recordVisit adds a visit to a channel's voice room to the call history of the user
+func (h *RouteHandler) recordVisit(user *schemas.User, channel *schemas.Channel, joinedAt time.Time) {
+	record := newCallRecord(user.Id, joinedAt, public.CallOutcomeAnswered)
+	record.ChannelId = uuid.NullUUID{UUID: channel.Id, Valid: true}
+	endCallRecord(record, joinedAt)
+	if err := dal.CreateCallRecord(h.db, record); err != nil {
+		log.Println(fmt.Errorf("error recording channel visit: %w", err))
+	}
+}
+
+// newCallRecord creates a record of a call without an end
+func newCallRecord(callerId uuid.UUID, startedAt time.Time, outcome string) *schemas.CallRecord {
+	record := &schemas.CallRecord{Id: uuid.New(), CallerId: callerId}
+	record.Outcome = outcome
+	record.StartedAt = startedAt
+	return record
+}
+
+// endCallRecord records that a call ended now. answeredAt is zero if the call never connected, in which case
+// it has no duration.
+func endCallRecord(record *schemas.CallRecord, answeredAt time.Time) {
+	endedAt := time.Now()
+	record.EndedAt = &endedAt
+	if !answeredAt.IsZero() {
+		duration := int(endedAt.Sub(answeredAt).Seconds())
+		record.Duration = &duration
+	}
+}
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gregriff/vogo/server/internal/middleware"
+	"github.com/gregriff/vogo/server/internal/schemas/public"
+)
+
+// ICEServers returns the ICE servers the client should use for its PeerConnections. If the STUN server
+// or TURN relay of the vogo server are enabled, they are included, with relay credentials that expire.
+func (h *RouteHandler) ICEServers(w http.ResponseWriter, req *http.Request) {
+	username := middleware.GetUsername(req)
+
+	servers, err := h.ice.ICEServers(username, req.Host)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "error issuing ice servers", http.StatusInternalServerError)
+		return
+	}
+
+	res := public.ICEServersResponse{ICEServers: servers}
+	WriteJSON(w, &res)
+}
@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gregriff/vogo/server/internal/crypto"
 	"github.com/gregriff/vogo/server/internal/dal"
+	"github.com/gregriff/vogo/server/internal/media"
 	"github.com/gregriff/vogo/server/internal/middleware"
 	"github.com/gregriff/vogo/server/internal/schemas"
 	"github.com/gregriff/vogo/server/internal/schemas/public"
@@ -23,21 +25,29 @@ func (h *RouteHandler) Register(w http.ResponseWriter, req *http.Request) {
 	}
 	log.Printf("new user parsed: %#v", data)
 
-	err, statusCode := validation.CheckRegistrationCredentials(h.db, data.InviteCode, data.Name, data.Password)
+	err, statusCode := validation.CheckRegistrationCredentials(h.db, data.InviteCode, data.Name, data.Password, data.PublicKey)
 	if err != nil {
 		http.Error(w, err.Error(), statusCode)
 		return
 	}
 
-	hashedPassword, err := crypto.HashPassword(data.Password)
-	if err != nil {
-		log.Println(err.Error())
-		err = errors.New("password error")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	var hashedPassword string
+	if data.Password != "" {
+		hashedPassword, err = crypto.HashPassword(data.Password)
+		if err != nil {
+			log.Println(err.Error())
+			err = errors.New("password error")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 	}
 
-	username, err := dal.CreateUser(h.db, data.Name, hashedPassword, data.InviteCode)
+	var publicKey []byte
+	if data.PublicKey != "" {
+		publicKey, _ = crypto.ParsePublicKey(data.PublicKey) // validated above
+	}
+
+	username, err := dal.CreateUser(h.db, data.Name, hashedPassword, publicKey, data.InviteCode)
 	if err != nil {
 		log.Println(err.Error())
 		err = errors.New("error creating new user")
@@ -74,11 +84,25 @@ func (h *RouteHandler) Status(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// TODO: check for any pending calls with callMap
-	res := public.StatusResponse{Friends: friends, Channels: channels}
+	missedCalls, err := dal.GetMissedCalls(h.db, user.Id, time.Now().Add(-missedCallsWindow))
+	if err != nil {
+		err = fmt.Errorf("error getting missed calls: %w", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := public.StatusResponse{
+		Friends:     friends,
+		Channels:    channels,
+		MissedCalls: missedCalls,
+		STUNServer:  h.ice.STUNURL(req.Host),
+	}
 	WriteJSON(w, &res)
 }
 
+// maxMeshCapacity is the most members a mesh channel can have, since each member uploads their audio to every other member
+const maxMeshCapacity = 10
+
 // CreateChannel creates a persistent voice-chat channel.
 func (h *RouteHandler) CreateChannel(w http.ResponseWriter, req *http.Request) {
 	username := middleware.GetUsername(req)
@@ -102,9 +126,29 @@ func (h *RouteHandler) CreateChannel(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	switch channel.Mode {
+	case "":
+		channel.Mode = public.ChannelModeMesh
+	case public.ChannelModeMesh, public.ChannelModeSFU, public.ChannelModeMCU:
+	default:
+		err = fmt.Errorf("unknown channel mode: %s", channel.Mode)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !media.Supports(channel.Mode) {
+		err = fmt.Errorf("this server does not support %s channels", channel.Mode)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	if channel.Capacity < 2 {
 		channel.Capacity = 6
 	}
+	if channel.Mode == public.ChannelModeMesh && channel.Capacity > maxMeshCapacity {
+		err = fmt.Errorf("mesh channels are limited to %d members, use an sfu channel", maxMeshCapacity)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	dbChannel, err := dal.CreateChannel(h.db, user.Id, channel)
 	if err != nil {
@@ -138,13 +182,21 @@ func (h *RouteHandler) AddFriend(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	friend, err := dal.AddFriend(h.db, user.Id, data.Name)
+	friend, status, err := dal.AddFriend(h.db, user.Id, data.Name)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	WriteJSON(w, &friend)
+	events := schemas.GetEvents()
+	switch status {
+	case "pending":
+		events.Publish(friend.Id, public.Event{Type: public.EventFriendRequest, From: user.Name})
+	case "accepted":
+		events.Publish(friend.Id, public.Event{Type: public.EventFriendAccepted, From: user.Name})
+	}
+
+	WriteJSON(w, &friend.User)
 }
 
 // InviteFriend invites a friend to an existing channel. Currently they join immediately (without having to accept)
@@ -181,5 +233,8 @@ func (h *RouteHandler) InviteFriend(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	WriteJSON(w, &friend)
+	event := public.Event{Type: public.EventChannelInvite, From: user.Name, Channel: data.ChannelName}
+	schemas.GetEvents().Publish(friend.Id, event)
+
+	WriteJSON(w, &friend.User)
 }
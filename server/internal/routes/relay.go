@@ -0,0 +1,77 @@
+package routes
+
+import (
+	"context"
+	"io"
+	"log"
+	"time"
+
+	"github.com/gregriff/vogo/protocol"
+	"github.com/gregriff/vogo/server/internal/schemas"
+)
+
+// relayCall forwards the signaling messages a client sends once its call has connected, such as the offers
+// and candidates of an ICE restart, to the other client's outbox, and writes the messages of the other client
+// from inbox to the websocket. It returns once either client hangs up or disconnects, after sending
+// protocol.ControlHangup to the client if it wasn't the one that hung up.
+func relayCall(
+	ctx context.Context,
+	sig *signaler,
+	call *schemas.Call,
+	incoming <-chan protocol.Envelope,
+	closed <-chan error,
+	outbox chan<- protocol.Envelope,
+	inbox <-chan protocol.Envelope,
+) {
+	defer call.HangUp()
+
+	// the call outlives the read timeout of the http server
+	_ = sig.ws.SetDeadline(time.Time{})
+
+	role := "recipient"
+	if outbox == call.ToRecipient {
+		role = "caller"
+	}
+	log.Printf("relaying signaling for the %s of the call from %s", role, call.Caller().Name)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-call.HungUp():
+			if err := sig.sendControl(protocol.ControlHangup); err != nil {
+				log.Printf("error writing hangup: %v", err)
+			}
+			return
+		case err := <-closed:
+			if err != io.EOF {
+				log.Printf("error reading from %s: %v", role, err)
+			}
+			log.Printf("%s disconnected", role)
+			return
+		case env := <-incoming:
+			switch env.Type {
+			case protocol.TypeOffer, protocol.TypeAnswer, protocol.TypeCandidate, protocol.TypeEndOfCandidates:
+				select {
+				case outbox <- env:
+				default:
+					log.Printf("dropped %s from %s, too many messages waiting to be relayed", env.Type, role)
+				}
+			case protocol.TypeControl:
+				var control protocol.Control
+				if err := env.Decode(&control); err == nil && control.Control == protocol.ControlHangup {
+					log.Printf("%s hung up", role)
+					return
+				}
+				log.Printf("unexpected control from %s during call", role)
+			default:
+				log.Printf("unexpected %s from %s during call", env.Type, role)
+			}
+		case env := <-inbox:
+			if err := sig.forward(env); err != nil {
+				log.Printf("error writing %s to %s: %v", env.Type, role, err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gregriff/vogo/server/internal/crypto"
+	"github.com/gregriff/vogo/server/internal/dal"
+	"github.com/gregriff/vogo/server/internal/middleware"
+	"github.com/gregriff/vogo/server/internal/schemas"
+	"github.com/gregriff/vogo/server/internal/schemas/public"
+)
+
+// maxDeviceLength is the longest device name a session can have
+const maxDeviceLength = 64
+
+// Challenge issues a challenge for a client that logs in with a key pair to sign. Challenges are issued
+// for any username, so that they don't reveal which users exist.
+func (h *RouteHandler) Challenge(w http.ResponseWriter, req *http.Request) {
+	data := schemas.ChallengeRequest{}
+	if err := json.NewDecoder(req.Body).Decode(&data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	challenge, err := h.challenges.Issue(data.Name)
+	if err != nil {
+		log.Println(fmt.Errorf("challenge error: %w", err))
+		http.Error(w, "error issuing challenge", http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, &public.ChallengeResponse{Challenge: challenge})
+}
+
+// Login checks the client's username and password, or its signature of a challenge from Challenge, and creates
+// a session. The returned token authenticates every other request, so credentials are only checked here.
+func (h *RouteHandler) Login(w http.ResponseWriter, req *http.Request) {
+	data := schemas.LoginRequest{}
+	if err := json.NewDecoder(req.Body).Decode(&data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := dal.GetUserWithPassword(h.db, data.Name)
+	if err == nil {
+		if data.Signature != "" {
+			err = h.checkSignature(user, data.Challenge, data.Signature)
+		} else {
+			err = crypto.CompareHashAndPassword(user.Password, data.Password)
+		}
+	}
+	if err != nil {
+		log.Println(fmt.Errorf("login error: %w", err))
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	data.Device = strings.TrimSpace(data.Device)
+	if len(data.Device) > maxDeviceLength {
+		err = fmt.Errorf("device name must be %d characters or less", maxDeviceLength)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, tokenHash, refreshHash, err := h.newSessionTokens()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "error creating session", http.StatusInternalServerError)
+		return
+	}
+	ip := middleware.GetClientIP(req)
+	if err = dal.CreateSession(h.db, user.Id, data.Device, ip, tokenHash, refreshHash, h.sessions); err != nil {
+		log.Println(err)
+		http.Error(w, "error creating session", http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, res)
+}
+
+// checkSignature verifies a user's signature of a challenge, which can't be used again afterwards
+func (h *RouteHandler) checkSignature(user *schemas.UserWithPassword, challenge, signature string) error {
+	if !h.challenges.Consume(user.Name, challenge) {
+		return errors.New("challenge not issued to user, expired or already used")
+	}
+	return crypto.VerifyChallenge(user.PublicKey, user.Name, challenge, signature)
+}
+
+// Refresh replaces the tokens of a session given its refresh token, which may be used once
+func (h *RouteHandler) Refresh(w http.ResponseWriter, req *http.Request) {
+	data := schemas.RefreshRequest{}
+	if err := json.NewDecoder(req.Body).Decode(&data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, tokenHash, refreshHash, err := h.newSessionTokens()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "error refreshing session", http.StatusInternalServerError)
+		return
+	}
+	ip := middleware.GetClientIP(req)
+	_, err = dal.RefreshSession(h.db, crypto.HashToken(data.RefreshToken), tokenHash, refreshHash, ip, h.sessions)
+	if err != nil {
+		log.Println(fmt.Errorf("refresh error: %w", err))
+		if errors.Is(err, dal.ErrSessionNotFound) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		} else {
+			http.Error(w, "error refreshing session", http.StatusInternalServerError)
+		}
+		return
+	}
+	WriteJSON(w, res)
+}
+
+// Logout revokes the session that authenticated the request
+func (h *RouteHandler) Logout(w http.ResponseWriter, req *http.Request) {
+	sessionId, ok := middleware.GetSessionId(req)
+	if !ok {
+		err := errors.New("not logged in with a session")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := dal.RevokeSession(h.db, sessionId); err != nil {
+		log.Println(err)
+		http.Error(w, "error revoking session", http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, &struct{}{})
+}
+
+// Sessions lists the client's user's sessions that have not been revoked or expired
+func (h *RouteHandler) Sessions(w http.ResponseWriter, req *http.Request) {
+	username := middleware.GetUsername(req)
+
+	user, err := dal.GetUser(h.db, username)
+	if err != nil {
+		err = fmt.Errorf("error getting user: %w", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sessions, err := dal.GetSessions(h.db, user.Id)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "error getting sessions", http.StatusInternalServerError)
+		return
+	}
+
+	if current, ok := middleware.GetSessionId(req); ok {
+		for i := range sessions {
+			sessions[i].Current = sessions[i].Id == current.String()
+		}
+	}
+	WriteJSON(w, &public.SessionsResponse{Sessions: sessions})
+}
+
+// RevokeSession revokes one of the client's user's sessions by id. Requests made with
+// its token fail afterwards, and it can't be refreshed.
+func (h *RouteHandler) RevokeSession(w http.ResponseWriter, req *http.Request) {
+	username := middleware.GetUsername(req)
+
+	sessionId, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid session id", http.StatusBadRequest)
+		return
+	}
+
+	user, err := dal.GetUser(h.db, username)
+	if err != nil {
+		err = fmt.Errorf("error getting user: %w", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err = dal.RevokeUserSession(h.db, user.Id, sessionId); err != nil {
+		if errors.Is(err, dal.ErrSessionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			log.Println(err)
+			http.Error(w, "error revoking session", http.StatusInternalServerError)
+		}
+		return
+	}
+	log.Printf("%s revoked session %s", username, sessionId)
+	WriteJSON(w, &struct{}{})
+}
+
+// newSessionTokens generates the tokens of a session along with their hashes, which are stored instead of the tokens
+func (h *RouteHandler) newSessionTokens() (res *public.SessionResponse, tokenHash, refreshHash []byte, err error) {
+	token, err := crypto.GenerateToken()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error generating token: %w", err)
+	}
+	refreshToken, err := crypto.GenerateToken()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error generating refresh token: %w", err)
+	}
+
+	now := time.Now()
+	res = &public.SessionResponse{
+		Token:            token,
+		RefreshToken:     refreshToken,
+		ExpiresAt:        now.Add(h.sessions.Token),
+		RefreshExpiresAt: now.Add(h.sessions.Refresh),
+	}
+	return res, crypto.HashToken(token), crypto.HashToken(refreshToken), nil
+}
@@ -0,0 +1,116 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gregriff/vogo/protocol"
+	"golang.org/x/net/websocket"
+)
+
+// signaler sends and recieves the protocol envelopes of a 1:1 call on a websocket, in the protocol
+// version negotiated with the client by SignalingHandshake
+type signaler struct {
+	ws    *websocket.Conn
+	codec websocket.Codec
+
+	// the negotiated protocol version, which is 0 for the legacy protocol
+	version int
+}
+
+func newSignaler(ws *websocket.Conn) *signaler {
+	codec := protocol.NewCodec(ws.Config().Protocol)
+	return &signaler{
+		ws:      ws,
+		version: codec.Version(),
+		codec: websocket.Codec{
+			Marshal: func(v any) ([]byte, byte, error) {
+				data, err := codec.Marshal(v.(protocol.Envelope))
+				return data, websocket.TextFrame, err
+			},
+			Unmarshal: func(data []byte, _ byte, v any) error {
+				env, err := codec.Unmarshal(data)
+				*v.(*protocol.Envelope) = env
+				return err
+			},
+		},
+	}
+}
+
+// SignalingHandshake selects the signaling protocol version from the websocket subprotocols offered by the client
+func SignalingHandshake(config *websocket.Config, _ *http.Request) error {
+	selected, err := protocol.Negotiate(config.Protocol)
+	if err != nil {
+		return err
+	}
+	config.Protocol = selected
+	return nil
+}
+
+// ChannelHandshake selects the version of the messages of a channel's voice room from the websocket subprotocols
+// offered by the client
+func ChannelHandshake(config *websocket.Config, _ *http.Request) error {
+	selected, err := protocol.NegotiateChannel(config.Protocol)
+	if err != nil {
+		return err
+	}
+	config.Protocol = selected
+	return nil
+}
+
+// send writes a message of a given type to the websocket. payload may be nil for types without one.
+func (s *signaler) send(t protocol.Type, payload any) error {
+	env, err := protocol.NewEnvelope(t, payload)
+	if err != nil {
+		return err
+	}
+	return s.codec.Send(s.ws, env)
+}
+
+// forward writes a message recieved from the other client of a call to the websocket, in the
+// protocol version negotiated with this client
+func (s *signaler) forward(env protocol.Envelope) error {
+	return s.codec.Send(s.ws, env)
+}
+
+// sendControl writes a control message to the websocket
+func (s *signaler) sendControl(control protocol.ControlType) error {
+	return s.send(protocol.TypeControl, protocol.Control{Control: control})
+}
+
+// sendError writes an error message to the websocket before it is closed. Legacy clients
+// cannot recieve errors, and only see the websocket close.
+func (s *signaler) sendError(message string) {
+	err := s.send(protocol.TypeError, protocol.Error{Message: message})
+	if err != nil && !errors.Is(err, protocol.ErrUnsupported) {
+		log.Printf("error writing error: %v", err)
+	}
+}
+
+// relays returns true if the client keeps its websocket open once the call connects, so that it
+// can restart ICE and hang up through the server
+func (s *signaler) relays() bool {
+	return s.version >= protocol.RelayVersion
+}
+
+// receive reads the next message from the websocket, cancelling the read if ctx is cancelled
+func (s *signaler) receive(ctx context.Context) (protocol.Envelope, error) {
+	var env protocol.Envelope
+	err := receiveCodecWithContext(ctx, s.ws, s.codec, &env)
+	return env, err
+}
+
+// receiveAs reads the next message from the websocket, which must be of a given type, and decodes its payload into v
+func (s *signaler) receiveAs(ctx context.Context, t protocol.Type, v any) error {
+	env, err := s.receive(ctx)
+	if err != nil {
+		return err
+	}
+	if env.Type != t {
+		return fmt.Errorf("expected %s, got %s", t, env.Type)
+	}
+	return env.Decode(v)
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -9,9 +10,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/gregriff/vogo/protocol"
 	"github.com/gregriff/vogo/server/internal/dal"
+	"github.com/gregriff/vogo/server/internal/media"
 	"github.com/gregriff/vogo/server/internal/middleware"
 	"github.com/gregriff/vogo/server/internal/schemas"
+	"github.com/gregriff/vogo/server/internal/schemas/public"
 	"github.com/pion/webrtc/v4"
 	"golang.org/x/net/websocket"
 )
@@ -23,15 +27,23 @@ import (
 // PUT /channel: modify channel properties
 // DELETE /channel
 
+var errCallCancelled = errors.New("call cancelled")
+
 // Call initiates signaling for a voice call that may only be accepted by the intended recipient. The caller's
 // ICE candidates are stored in memory until the recipient answers, where they are then forwarded. Call then
 // recieves the recipient's ICE candidates and forwards them to the caller. When candidates have been fully
-// exchanged Call deletes the signaling data from memory and returns.
-// Note: the channel version of this func will need to stay open until the client exits the channel call.
+// exchanged Call deletes the signaling data from memory and returns. If the recipient is busy, declines, or
+// does not answer in time, the caller is sent a protocol.Control instead of an answer.
+// If both clients negotiated protocol.RelayVersion, Call instead stays open once signaling completes,
+// relaying the caller's signaling messages until either client hangs up.
 func (h *RouteHandler) Call(ws *websocket.Conn) {
-	ctx, cancel := context.WithTimeout(ws.Request().Context(), time.Second*30)
+	// outlives ctx if the call is relayed
+	connCtx, cancelConn := context.WithCancel(ws.Request().Context())
+	defer cancelConn()
+	ctx, cancel := context.WithTimeout(connCtx, h.timeouts.Ring)
 	defer cancel()
 
+	sig := newSignaler(ws)
 	username := middleware.GetUsernameWS(ws)
 	caller, err := dal.GetUser(h.db, username)
 	if err != nil {
@@ -40,25 +52,28 @@ func (h *RouteHandler) Call(ws *websocket.Conn) {
 		return
 	}
 
-	var offer schemas.CallRequest
-	err = receiveWithContext(ctx, ws, &offer)
+	var offer protocol.Offer
+	err = sig.receiveAs(ctx, protocol.TypeOffer, &offer)
 	if err != nil {
 		if err == io.EOF {
 			return
 		}
 		log.Printf("error reading offer from ws: %v", err)
+		sig.sendError("invalid offer")
 		_ = ws.WriteClose(http.StatusBadRequest)
 		return
 	}
-	if offer.Sd.SDP == "" {
+	if offer.SD.SDP == "" {
 		log.Println("empty offer")
+		sig.sendError("empty offer")
 		_ = ws.WriteClose(http.StatusBadRequest)
 		return
 	}
 	log.Println("callWS: offer recieved")
-	recipient, err := dal.GetUser(h.db, offer.RecipientName)
+	recipient, err := dal.GetUser(h.db, offer.Recipient)
 	if err != nil {
 		log.Println(fmt.Errorf("error fetching recipient: %w", err))
+		sig.sendError("recipient not found")
 		_ = ws.WriteClose(http.StatusBadRequest)
 		return
 	}
@@ -71,22 +86,52 @@ func (h *RouteHandler) Call(ws *websocket.Conn) {
 	}
 	if !friends {
 		log.Println(fmt.Errorf("caller not friends with recipient: %w", err))
+		sig.sendError("not friends with recipient")
 		_ = ws.WriteClose(http.StatusBadRequest)
 		return
 	}
 
-	// create the call in memory, delete once answered
-	call := schemas.CreateCall(caller, recipient, offer.Sd)
+	// create the call in memory, delete once signaling completes
 	calls := schemas.GetPendingCalls()
-	defer calls.Delete(caller.Id)
+	call, err := schemas.CreateCall(caller, recipient, offer.SD, sig.relays())
+	if errors.Is(err, schemas.ErrRecipientBusy) {
+		log.Printf("callWS: %s is busy", recipient.Name)
+		_ = sig.sendControl(protocol.ControlBusy)
+		return
+	}
+	if err != nil {
+		log.Println(fmt.Errorf("error creating call: %w", err))
+		sig.sendError(err.Error())
+		_ = ws.WriteClose(http.StatusConflict)
+		return
+	}
+	defer func() {
+		h.recordCall(call, calls.Delete(call))
+	}()
+	defer close(call.CallerLeft)
+	defer call.HangUp()
 	log.Println("call created")
 
+	if schemas.GetEvents().Online(recipient.Id) {
+		if err := calls.Transition(call, schemas.CallRinging); err != nil {
+			log.Println(err)
+			return
+		}
+		// legacy clients expect nothing but an answer, so they aren't told that the call is ringing
+		if sig.version >= 1 {
+			if err := sig.sendControl(protocol.ControlRinging); err != nil {
+				log.Printf("error writing ringing: %v", err)
+				return
+			}
+		}
+	}
+
 	// read incoming candidates
 	var (
 		readIce                   sync.WaitGroup
 		readIceCtx, cancelReadIce = context.WithCancel(ctx)
 		readChan                  = make(chan webrtc.ICECandidateInit)
-		canListenForClose         = make(chan struct{}, 1)
+		iceGathered               = make(chan struct{}, 1)
 	)
 	defer func() {
 		cancelReadIce()
@@ -94,59 +139,80 @@ func (h *RouteHandler) Call(ws *websocket.Conn) {
 		readIce.Wait()
 	}()
 	readIce.Go(func() {
-		defer close(canListenForClose)
+		defer close(iceGathered)
 		defer cancelReadIce()
-		err := readCandidates(readIceCtx, ws, readChan)
+		err := readCandidates(readIceCtx, sig, readChan)
 		if err != nil {
-			if err == io.EOF {
+			if err == io.EOF || errors.Is(err, errCallCancelled) {
 				cancel()
 				return
 			}
 			log.Println("error during ice reading: ", err)
 		}
-		canListenForClose <- struct{}{}
+		iceGathered <- struct{}{}
 	})
 
-	// listen for the close frame from the client, since we know the only
-	// thing the client could possibly send after ICE gather is a close frame
+	// once ICE gather completes, the client either closes the websocket, or if the call is relayed,
+	// sends signaling messages until it hangs up
 	var (
-		listen sync.WaitGroup
-		closed = make(chan struct{}, 1)
+		listen   sync.WaitGroup
+		incoming = make(chan protocol.Envelope)
+		closed   = make(chan error, 1)
 	)
-	defer listen.Wait()
+	defer func() {
+		cancelConn()
+		listen.Wait()
+	}()
 	listen.Go(func() {
-		// wait for ice gather to complete
-		if _, ok := <-canListenForClose; !ok {
+		if _, ok := <-iceGathered; !ok {
 			return
 		}
-		err := receiveWithContext(ctx, ws, &struct{}{})
-		if err == io.EOF {
-			log.Println("listenForClose EOF")
-			closed <- struct{}{}
-		} else if err != nil {
-			log.Println("listenForClose NON EOF ERR: ", err)
-		}
+		closed <- readSignaling(connCtx, sig, incoming)
 	})
 
-	for {
+	answered := false
+	recipientCandidates := call.To.Candidates
+	for readChan != nil || recipientCandidates != nil {
 		select {
 		case <-ctx.Done():
-		case <-closed:
-			log.Println("Call req context done or conn closed")
-			cancel()
+			if !answered && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				log.Println("callWS: call timed out")
+				_ = sig.sendControl(protocol.ControlTimeout)
+			}
+			return
+		case err := <-closed:
+			if err != io.EOF {
+				log.Printf("error reading from caller: %v", err)
+			}
+			log.Println("callWS: caller closed the connection")
+			return
+		case control := <-call.Control:
+			log.Printf("callWS: call %s", control)
+			if err := sig.sendControl(control); err != nil {
+				log.Printf("error writing %s: %v", control, err)
+			}
 			return
 		case answerSd := <-call.Answer:
-			if err := websocket.JSON.Send(ws, answerSd); err != nil {
+			answered = true
+			if err := sig.send(protocol.TypeAnswer, protocol.Answer{SD: answerSd}); err != nil {
 				log.Printf("error writing answer: %v", err)
 				return
 			}
-		case answerCandidate, ok := <-call.To.Candidates:
-			if err := websocket.JSON.Send(ws, answerCandidate); err != nil {
-				log.Printf("error writing candidate: %v", err)
-				return
-			}
-			// we've sent the caller the recipient's last candidate. nothing left to do
+		case answerCandidate, ok := <-recipientCandidates:
 			if !ok {
+				if err := sig.send(protocol.TypeEndOfCandidates, nil); err != nil {
+					log.Printf("error writing end of candidates: %v", err)
+					return
+				}
+				// we've sent the caller the recipient's last candidate. unless the call is relayed, nothing left to do
+				if !call.Relayed() {
+					return
+				}
+				recipientCandidates = nil
+				continue
+			}
+			if err := sig.send(protocol.TypeCandidate, protocol.Candidate{Candidate: answerCandidate}); err != nil {
+				log.Printf("error writing candidate: %v", err)
 				return
 			}
 		// note: this must continue even if the above case completes. in the channel architecture, ensure this is the case?
@@ -161,14 +227,23 @@ func (h *RouteHandler) Call(ws *websocket.Conn) {
 			fmt.Println("caller candidate sent")
 		}
 	}
+
+	// both clients have exchanged all of their candidates and are connecting
+	relayCall(connCtx, sig, call, incoming, closed, call.ToRecipient, call.ToCaller)
 }
 
 // Answer obtains the caller's name from the first ws message and sends the caller's offer Sd to the client.
 // It then waits for the clients answer, where it then facilitates trickle-ICE gathering between the two clients.
+// The client may decline instead of answering, which is forwarded to the caller. Like Call, Answer stays
+// open once signaling completes if the call is relayed, relaying the recipient's signaling messages.
 func (h *RouteHandler) Answer(ws *websocket.Conn) {
-	ctx, cancel := context.WithTimeout(ws.Request().Context(), time.Second*15)
+	// outlives ctx if the call is relayed
+	connCtx, cancelConn := context.WithCancel(ws.Request().Context())
+	defer cancelConn()
+	ctx, cancel := context.WithTimeout(connCtx, h.timeouts.Answer)
 	defer cancel()
 
+	sig := newSignaler(ws)
 	username := middleware.GetUsernameWS(ws)
 	recipient, err := dal.GetUser(h.db, username)
 	if err != nil {
@@ -193,6 +268,7 @@ func (h *RouteHandler) Answer(ws *websocket.Conn) {
 	}
 	if !friends {
 		log.Println(fmt.Errorf("recipient not friends with caller: %w", err))
+		sig.sendError("not friends with caller")
 		_ = ws.WriteClose(http.StatusBadRequest)
 		return
 	}
@@ -201,42 +277,118 @@ func (h *RouteHandler) Answer(ws *websocket.Conn) {
 	call, err := calls.Get(caller.Id)
 	if err != nil {
 		log.Println("call not found")
+		sig.sendError("call not found")
 		_ = ws.WriteClose(http.StatusBadRequest)
 		return
 	}
-	defer calls.Delete(caller.Id)
+	if !calls.State(call).Pending() {
+		log.Println("call already answered")
+		sig.sendError("call already answered")
+		_ = ws.WriteClose(http.StatusConflict)
+		return
+	}
+	defer calls.Delete(call)
+	defer call.HangUp()
 
 	// send caller's SD. client will then create an answer and post it to this ws
-	if err := websocket.JSON.Send(ws, call.From.Sd); err != nil {
+	if err := sig.send(protocol.TypeOffer, protocol.Offer{SD: call.From.Sd}); err != nil {
 		log.Printf("error writing offer: %v", err)
 		return
 	}
 
-	// wait for answer from client
-	var answer schemas.AnswerRequest
-	err = receiveWithContext(ctx, ws, &answer)
+	// wait for answer from client, unless the caller hangs up first
+	var (
+		reply      protocol.Envelope
+		readAnswer sync.WaitGroup
+		answerRead = make(chan error, 1)
+	)
+	readAnswer.Go(func() {
+		var err error
+		reply, err = sig.receive(ctx)
+		answerRead <- err
+	})
+	select {
+	case <-call.CallerLeft:
+		cancel()
+		readAnswer.Wait()
+		log.Println("answerWS: caller hung up")
+		_ = sig.sendControl(protocol.ControlCancelled)
+		return
+	case err = <-answerRead:
+	}
 	if err != nil {
 		if err == io.EOF {
 			return
 		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			log.Println("answerWS: call timed out")
+			_ = sig.sendControl(protocol.ControlTimeout)
+			return
+		}
+		log.Printf("error reading answer from ws: %v", err)
+		_ = ws.WriteClose(http.StatusBadRequest)
+		return
+	}
+
+	var answer protocol.Answer
+	switch reply.Type {
+	case protocol.TypeControl:
+		var control protocol.Control
+		if err = reply.Decode(&control); err != nil || control.Control != protocol.ControlDeclined {
+			log.Printf("unexpected control in place of answer: %v", err)
+			_ = ws.WriteClose(http.StatusBadRequest)
+			return
+		}
+		log.Println("answerWS: call declined")
+		// the call is no longer pending, so the recipient isn't told that it was cancelled
+		if err = calls.Transition(call, schemas.CallDeclined); err != nil {
+			log.Println(err)
+			return
+		}
+		select {
+		case call.Control <- protocol.ControlDeclined:
+		default:
+		}
+		return
+	case protocol.TypeAnswer:
+		err = reply.Decode(&answer)
+	default:
+		err = fmt.Errorf("expected answer, got %s", reply.Type)
+	}
+	if err != nil {
 		log.Printf("error reading answer from ws: %v", err)
+		sig.sendError("invalid answer")
 		_ = ws.WriteClose(http.StatusBadRequest)
 		return
 	}
-	if answer.Sd.SDP == "" {
+	if answer.SD.SDP == "" {
 		log.Println("empty answer")
+		sig.sendError("empty answer")
 		_ = ws.WriteClose(http.StatusBadRequest)
 		return
 	}
 	log.Println("answerWS: answer recieved")
-	call.Answer <- answer.Sd
+
+	// only one answer is forwarded, and not once the call has ended
+	if err = calls.Transition(call, schemas.CallAnswered); err != nil {
+		log.Println(err)
+		sig.sendError("call ended")
+		_ = ws.WriteClose(http.StatusConflict)
+		return
+	}
+	call.To.Relays = sig.relays()
+	call.Answer <- answer.SD
+	if err = calls.Transition(call, schemas.CallConnecting); err != nil {
+		log.Println(err)
+		return
+	}
 
 	// read incoming candidates
 	var (
 		readIce                   sync.WaitGroup
 		readIceCtx, cancelReadIce = context.WithCancel(ctx)
 		readChan                  = make(chan webrtc.ICECandidateInit)
-		canListenForClose         = make(chan struct{}, 1)
+		iceGathered               = make(chan struct{}, 1)
 	)
 	defer func() {
 		cancelReadIce()
@@ -244,9 +396,9 @@ func (h *RouteHandler) Answer(ws *websocket.Conn) {
 		readIce.Wait()
 	}()
 	readIce.Go(func() {
-		defer close(canListenForClose)
+		defer close(iceGathered)
 		defer cancelReadIce()
-		err := readCandidates(readIceCtx, ws, readChan)
+		err := readCandidates(readIceCtx, sig, readChan)
 		if err != nil {
 			if err == io.EOF {
 				cancel()
@@ -254,90 +406,257 @@ func (h *RouteHandler) Answer(ws *websocket.Conn) {
 			}
 			log.Println("error during ice reading: ", err)
 		}
-		canListenForClose <- struct{}{}
+		iceGathered <- struct{}{}
 	})
 
-	// listen for the close frame from the client, since we know the only
-	// thing the client could possibly send after ICE gather is a close frame
+	// once ICE gather completes, the client either closes the websocket, or if the call is relayed,
+	// sends signaling messages until it hangs up
 	var (
-		listen sync.WaitGroup
-		closed = make(chan struct{}, 1)
+		listen   sync.WaitGroup
+		incoming = make(chan protocol.Envelope)
+		closed   = make(chan error, 1)
 	)
-	defer listen.Wait()
+	defer func() {
+		cancelConn()
+		listen.Wait()
+	}()
 	listen.Go(func() {
-		// wait for ice gather to complete
-		if _, ok := <-canListenForClose; !ok {
+		if _, ok := <-iceGathered; !ok {
 			return
 		}
-		err := receiveWithContext(ctx, ws, &struct{}{})
-		if err == io.EOF {
-			log.Println("listenForClose EOF")
-			closed <- struct{}{}
-		} else if err != nil {
-			log.Println("listenForClose NON EOF ERR: ", err)
-		}
+		closed <- readSignaling(connCtx, sig, incoming)
 	})
 
-	for {
+	callerCandidates := call.From.Candidates
+	for readChan != nil || callerCandidates != nil {
 		select {
 		case <-ctx.Done():
-		case <-closed:
-			log.Println("Answer req context done or conn closed")
-			cancel()
+			return
+		case err := <-closed:
+			if err != io.EOF {
+				log.Printf("error reading from recipient: %v", err)
+			}
+			log.Println("answerWS: recipient closed the connection")
 			return
 		// note: this needs to continue to run even if readchan is closed. this may always complete first tho...
-		case candidate, ok := <-call.From.Candidates:
+		case candidate, ok := <-callerCandidates:
 			if !ok {
-				call.From.Candidates = nil
+				callerCandidates = nil
+				err = sig.send(protocol.TypeEndOfCandidates, nil)
+			} else {
+				err = sig.send(protocol.TypeCandidate, protocol.Candidate{Candidate: candidate})
 			}
-			if err := websocket.JSON.Send(ws, candidate); err != nil {
-				log.Printf("error writing answer: %v", err)
+			if err != nil {
+				log.Printf("error writing candidate: %v", err)
 				return
 			}
 		case answerCandidate, ok := <-readChan:
 			if !ok { // recipient gather completed
+				// connected before the caller's handler sees the end of candidates and returns
+				if err := calls.Transition(call, schemas.CallConnected); err != nil {
+					log.Println(err)
+				}
 				close(call.To.Candidates)
+				if !call.Relayed() {
+					return
+				}
+				readChan = nil
+				continue
+			}
+			call.To.Candidates <- answerCandidate
+			fmt.Println("answer candidate sent")
+		}
+	}
+
+	// both clients have exchanged all of their candidates and are connecting
+	relayCall(connCtx, sig, call, incoming, closed, call.ToCaller, call.ToRecipient)
+}
+
+// Join adds the client to the voice room of a channel they are a member of, up to the channel's capacity.
+// The client is first sent the names of the members already present. In a mesh channel, each of those members
+// then sends the client an offer, which Join forwards along with their ICE candidates, and forwards the client's
+// answers and candidates back, so that every member holds a PeerConnection to every other member. In other
+// modes, the client holds a single PeerConnection to the server's media package instead.
+// Unlike Call, Join stays open until the client leaves the room by closing the websocket.
+func (h *RouteHandler) Join(ws *websocket.Conn) {
+	ctx, cancel := context.WithCancel(ws.Request().Context())
+	defer cancel()
+
+	// the room outlives the read timeout of the http server
+	_ = ws.SetDeadline(time.Time{})
+
+	username := middleware.GetUsernameWS(ws)
+	user, err := dal.GetUser(h.db, username)
+	if err != nil {
+		log.Println(fmt.Errorf("error fetching user: %w", err))
+		_ = ws.WriteClose(http.StatusInternalServerError)
+		return
+	}
+
+	channelName := ws.Request().PathValue("name")
+	channel, err := dal.GetMemberChannel(h.db, user.Id, channelName)
+	if err != nil {
+		log.Println(fmt.Errorf("error fetching channel: %w", err))
+		_ = websocket.JSON.Send(ws, protocol.ChannelMessage{Type: protocol.ChannelError, Error: err.Error()})
+		_ = ws.WriteClose(http.StatusBadRequest)
+		return
+	}
+
+	rooms := schemas.GetRooms()
+	member, present, err := rooms.Join(channel, user)
+	if err != nil {
+		log.Println(fmt.Errorf("error joining room: %w", err))
+		_ = websocket.JSON.Send(ws, protocol.ChannelMessage{Type: protocol.ChannelError, Error: err.Error()})
+		_ = ws.WriteClose(http.StatusConflict)
+		return
+	}
+	defer rooms.Leave(channel.Id, user.Id)
+	defer h.recordVisit(user, channel, time.Now())
+	log.Printf("%s joined %s", user.Name, channel.Name)
+
+	// with server-side media the client only signals with the server, which sends the first offer
+	var participant media.Participant
+	if channel.Mode != public.ChannelModeMesh {
+		participant, err = media.Join(channel, user.Name, member.Outbox)
+		if err != nil {
+			log.Println(fmt.Errorf("error joining media: %w", err))
+			_ = websocket.JSON.Send(ws, protocol.ChannelMessage{Type: protocol.ChannelError, Error: "media error"})
+			_ = ws.WriteClose(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	members := protocol.ChannelMessage{Type: protocol.ChannelMembers, Members: present, Mode: channel.Mode}
+	if err := websocket.JSON.Send(ws, members); err != nil {
+		log.Printf("error writing members: %v", err)
+		if participant != nil {
+			participant.Close()
+		}
+		return
+	}
+
+	// forward messages from the client to other members until the client leaves
+	var (
+		read   sync.WaitGroup
+		closed = make(chan error, 1)
+	)
+	defer func() {
+		cancel()
+		_ = ws.Close()
+		// the participant is closed first, since signaling it may be waiting on the media of the room
+		if participant != nil {
+			participant.Close()
+		}
+		read.Wait()
+	}()
+	read.Go(func() {
+		for {
+			var msg protocol.ChannelMessage
+			if err := receiveWithContext(ctx, ws, &msg); err != nil {
+				closed <- err
 				return
 			}
-			call, err := calls.Get(caller.Id)
+			var err error
+			if participant != nil {
+				err = participant.Signal(msg)
+			} else {
+				err = rooms.Forward(channel.Id, user, msg)
+			}
 			if err != nil {
-				log.Print("answer: call not found during trickle ice")
+				log.Printf("error forwarding %s from %s: %v", msg.Type, user.Name, err)
+			}
+		}
+	})
+
+	// the only writer to ws, so messages from other members are sent in order
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-closed:
+			if err != io.EOF {
+				log.Printf("error reading from %s: %v", user.Name, err)
+			}
+			log.Printf("%s left %s", user.Name, channel.Name)
+			return
+		case <-member.Dropped():
+			// the client would never connect to whoever sent the missed message, so it has to rejoin
+			log.Printf("dropped %s from %s: outbox full", user.Name, channel.Name)
+			_ = websocket.JSON.Send(ws, protocol.ChannelMessage{Type: protocol.ChannelError, Error: "missed messages, rejoin"})
+			return
+		case msg := <-member.Outbox:
+			if err := websocket.JSON.Send(ws, msg); err != nil {
+				log.Printf("error writing %s to %s: %v", msg.Type, user.Name, err)
 				return
 			}
-			call.To.Candidates <- answerCandidate
-			fmt.Println("answer candidate sent")
 		}
 	}
 }
 
-// readCandidates reads from ws in a loop, sending candidates read to the channel ch.
-// When an empty candidate is read, the channel is closed, signalling that ICE gather on this
+// readCandidates reads from the signaler in a loop, sending candidates read to the channel ch.
+// When the end of candidates is read, the channel is closed, signalling that ICE gather on this
 // websocket is finished. If the ws is closed or there is an error while reading, the ws is closed and the loop stops.
-func readCandidates(ctx context.Context, ws *websocket.Conn, ch chan webrtc.ICECandidateInit) error {
-	var candidate webrtc.ICECandidateInit
+// If the caller cancels the call instead, errCallCancelled is returned.
+func readCandidates(ctx context.Context, sig *signaler, ch chan webrtc.ICECandidateInit) error {
 	for {
-		if err := receiveWithContext(ctx, ws, &candidate); err != nil {
+		env, err := sig.receive(ctx)
+		if err != nil {
 			if err == io.EOF {
 				return err // ws closed, propogate up
 			}
-			if cErr := ws.Close(); cErr != nil {
+			if cErr := sig.ws.Close(); cErr != nil {
 				return fmt.Errorf("error closing ws: %v, after err: %v", cErr, err)
 			}
 			return err
 		}
 
-		if candidate.Candidate == "" {
+		switch env.Type {
+		case protocol.TypeCandidate:
+			var candidate protocol.Candidate
+			if err = env.Decode(&candidate); err != nil {
+				log.Println(err)
+				continue
+			}
+			ch <- candidate.Candidate
+		case protocol.TypeEndOfCandidates:
 			close(ch)
 			log.Println("ice gather completed")
 			return nil
+		case protocol.TypeControl:
+			var control protocol.Control
+			if err = env.Decode(&control); err == nil && control.Control == protocol.ControlCancelled {
+				return errCallCancelled
+			}
+		default:
+			log.Printf("unexpected %s during ice gathering", env.Type)
+		}
+	}
+}
+
+// readSignaling reads messages from the signaler into ch until the websocket is closed or ctx is cancelled,
+// returning the error that stopped it. io.EOF is returned once the client closes the websocket.
+func readSignaling(ctx context.Context, sig *signaler, ch chan<- protocol.Envelope) error {
+	for {
+		env, err := sig.receive(ctx)
+		if err != nil {
+			return err
+		}
+		select {
+		case ch <- env:
+		case <-ctx.Done():
+			return ctx.Err()
 		}
-		ch <- candidate
 	}
 }
 
 // receiveWithContext reads json into v from ws in a new goroutine and cancels
 // the read if ctx is cancelled. Param v should be a pointer.
 func receiveWithContext(ctx context.Context, ws *websocket.Conn, v any) error {
+	return receiveCodecWithContext(ctx, ws, websocket.JSON, v)
+}
+
+// receiveCodecWithContext is receiveWithContext for a message of any codec
+func receiveCodecWithContext(ctx context.Context, ws *websocket.Conn, codec websocket.Codec, v any) error {
 	var (
 		recv sync.WaitGroup
 		done = make(chan error, 1)
@@ -345,7 +664,7 @@ func receiveWithContext(ctx context.Context, ws *websocket.Conn, v any) error {
 	defer recv.Wait()
 
 	recv.Go(func() {
-		done <- websocket.JSON.Receive(ws, v)
+		done <- codec.Receive(ws, v)
 	})
 
 	select {
@@ -3,47 +3,240 @@
 package schemas
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"log"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/gregriff/vogo/protocol"
+	"github.com/gregriff/vogo/server/internal/schemas/public"
 	"github.com/pion/webrtc/v4"
 )
 
+var (
+	ErrCallNotFound      = errors.New("call not found")
+	ErrCallExists        = errors.New("caller already has a pending call")
+	ErrRecipientBusy     = errors.New("recipient is busy")
+	ErrInvalidTransition = errors.New("invalid call state transition")
+)
+
+// CallState is the stage of a call's signaling. A call moves forward through the states, and
+// ends in CallConnected, CallDeclined, CallFailed or CallExpired.
+type CallState string
+
+const (
+	// the caller's offer was recieved
+	CallCreated CallState = "created"
+
+	// the recipient was listening for calls, and was notified
+	CallRinging CallState = "ringing"
+
+	// the recipient's answer was recieved
+	CallAnswered CallState = "answered"
+
+	// the answer was forwarded to the caller, and ICE candidates are being exchanged
+	CallConnecting CallState = "connecting"
+
+	// the recipient sent all of their ICE candidates. signaling is complete
+	CallConnected CallState = "connected"
+
+	// the recipient declined the call instead of answering it
+	CallDeclined CallState = "declined"
+
+	// the caller or recipient left or errored before signaling completed
+	CallFailed CallState = "failed"
+
+	// the call was not answered or connected in time
+	CallExpired CallState = "expired"
+)
+
+// callTransitions are the states a call may move to from each state
+var callTransitions = map[CallState][]CallState{
+	CallCreated:    {CallRinging, CallAnswered, CallDeclined, CallFailed, CallExpired},
+	CallRinging:    {CallAnswered, CallDeclined, CallFailed, CallExpired},
+	CallAnswered:   {CallConnecting, CallFailed, CallExpired},
+	CallConnecting: {CallConnected, CallFailed, CallExpired},
+}
+
+// Pending returns true if the call is waiting to be answered
+func (s CallState) Pending() bool {
+	return s == CallCreated || s == CallRinging
+}
+
+// Terminal returns true if the call cannot move to another state
+func (s CallState) Terminal() bool {
+	_, exists := callTransitions[s]
+	return !exists
+}
+
+// CallTimeouts bound how long each stage of a call may take
+type CallTimeouts struct {
+	// how long a call may wait to be answered
+	Ring time.Duration
+
+	// how long the recipient has to answer and exchange ICE candidates once they fetch the offer
+	Answer time.Duration
+
+	// how often stale calls are expired
+	Sweep time.Duration
+}
+
 // CallMap stores signaling information for pending calls.
-// (the time from when a call is created until it is answered).
-// Entries are deleted when the recipient answers or if the call fails.
+// (the time from when a call is created until its signaling completes, or until a relayed call is hung up).
+// Entries are deleted by the websocket handlers of the call once they return, or expired by Sweep.
+// Every state transition is made while holding the map's lock.
 // Takes a caller's UUID as a key
 type CallMap struct {
 	mu    sync.Mutex
-	calls map[uuid.UUID]Call
+	calls map[uuid.UUID]*Call
 }
 
-// Update inserts or updates a call for a given id
-func (m *CallMap) Update(id uuid.UUID, call Call) {
+// Get returns the call for a given id, returning an error if not found.
+// The state of a call should only be changed with CallMap.Transition
+func (m *CallMap) Get(id uuid.UUID) (*Call, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.calls[id] = call
+	if call, exists := m.calls[id]; exists {
+		return call, nil
+	} else {
+		return nil, ErrCallNotFound
+	}
 }
 
-// Get returns a copy of a call Call for a given id, returning an error if not found.
-// Updating a call should be done with CallMap.Update
-func (m *CallMap) Get(id uuid.UUID) (Call, error) {
+// State returns the current state of a call
+func (m *CallMap) State(call *Call) CallState {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	if call, exists := m.calls[id]; exists {
-		return call, nil
-	} else {
-		return Call{}, errors.New("call not found")
+	return call.state
+}
+
+// Transition moves a call to a new state, returning an error wrapping ErrInvalidTransition
+// if the call cannot move to it from its current state
+func (m *CallMap) Transition(call *Call, to CallState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.transitionLocked(call, to)
+}
+
+// transitionLocked is Transition. m.mu must be held.
+func (m *CallMap) transitionLocked(call *Call, to CallState) error {
+	if !slices.Contains(callTransitions[call.state], to) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, call.state, to)
+	}
+	log.Printf("call from %s to %s: %s -> %s", call.From.user.Name, call.To.user.Name, call.state, to)
+	call.state = to
+	call.changedAt = time.Now()
+	if to == CallAnswered {
+		call.AnsweredAt = call.changedAt
+	}
+	return nil
+}
+
+// Callers returns the names of the users with a pending call to the recipient with a given id
+func (m *CallMap) Callers(recipientId uuid.UUID) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var callers []string
+	for _, call := range m.calls {
+		if call.To.user.Id == recipientId && call.state.Pending() {
+			callers = append(callers, call.From.user.Name)
+		}
+	}
+	return callers
+}
+
+// busyLocked returns true if the user with a given id is calling someone, or has answered a call that hasn't
+// ended. m.mu must be held.
+func (m *CallMap) busyLocked(userId uuid.UUID) bool {
+	for _, call := range m.calls {
+		if !call.activeLocked() {
+			continue
+		}
+		if call.From.user.Id == userId || (call.To.user.Id == userId && !call.state.Pending()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Delete removes a call from the PendingCalls map, if it is still stored. A call that hasn't
+// completed signaling fails, and if it was never answered or declined the recipient is sent an event that it was
+// cancelled.
+// The final state of the call is returned, after which the call is no longer modified.
+func (m *CallMap) Delete(call *Call) CallState {
+	m.mu.Lock()
+	if m.calls[call.From.user.Id] == call {
+		delete(m.calls, call.From.user.Id)
+	}
+	pending := call.state.Pending()
+	if !call.state.Terminal() {
+		_ = m.transitionLocked(call, CallFailed)
+	}
+	state := call.state
+	m.mu.Unlock()
+
+	if pending {
+		GetEvents().Publish(call.To.user.Id, public.Event{Type: public.EventCallCancelled, From: call.From.user.Name})
+	}
+	return state
+}
+
+// Sweep expires calls that have not been answered within timeouts.Ring, or that have not connected within
+// timeouts.Answer of being answered, every timeouts.Sweep until ctx is cancelled. The caller of an expired
+// call is sent protocol.ControlTimeout. Calls that have ended are removed.
+func (m *CallMap) Sweep(ctx context.Context, timeouts CallTimeouts) {
+	ticker := time.NewTicker(timeouts.Sweep)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, call := range m.sweep(now, timeouts) {
+				GetEvents().Publish(call.To.user.Id, public.Event{Type: public.EventCallCancelled, From: call.From.user.Name})
+			}
+		}
 	}
 }
 
-// Delete removes a call entry from the PendingCalls map
-func (m *CallMap) Delete(id uuid.UUID) {
+// sweep expires and removes stale calls, returning the expired calls that were never answered
+func (m *CallMap) sweep(now time.Time, timeouts CallTimeouts) (unanswered []*Call) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	delete(m.calls, id)
+
+	for id, call := range m.calls {
+		if call.state.Terminal() {
+			if !call.activeLocked() {
+				delete(m.calls, id)
+			}
+			continue
+		}
+
+		pending := call.state.Pending()
+		if pending && now.Sub(call.CreatedAt) < timeouts.Ring {
+			continue
+		}
+		if !pending && now.Sub(call.changedAt) < timeouts.Answer {
+			continue
+		}
+
+		_ = m.transitionLocked(call, CallExpired)
+		delete(m.calls, id)
+		select {
+		case call.Control <- protocol.ControlTimeout:
+		default:
+		}
+		if pending {
+			unanswered = append(unanswered, call)
+		}
+	}
+	return unanswered
 }
 
 var (
@@ -54,7 +247,7 @@ var (
 // GetPendingCalls returns a singleton storing pending calls. Once migrated to websockets, this will be obsolete?
 func GetPendingCalls() *CallMap {
 	createCallStore.Do(func() {
-		pendingCalls = CallMap{calls: make(map[uuid.UUID]Call, 10)}
+		pendingCalls = CallMap{calls: make(map[uuid.UUID]*Call, 10)}
 	})
 	return &pendingCalls
 }
@@ -71,6 +264,75 @@ type Call struct {
 
 	// recipient sends their answer here
 	Answer chan webrtc.SessionDescription
+
+	// recipient sends protocol.ControlDeclined here instead of an answer,
+	// and Sweep sends protocol.ControlTimeout here when the call expires
+	Control chan protocol.ControlType
+
+	// closed once the caller's websocket handler returns, cancelling the call if it wasn't answered
+	CallerLeft chan struct{}
+
+	// once a relayed call connects, the signaling messages of each client are forwarded to the other through these
+	ToCaller,
+	ToRecipient chan protocol.Envelope
+
+	// closed by HangUp
+	hungUp chan struct{}
+	hangUp sync.Once
+
+	// set when the call moves to CallAnswered. Like the call's state, it is guarded
+	// by the lock of the CallMap storing the call until the call is deleted
+	AnsweredAt time.Time
+
+	// guarded by the lock of the CallMap storing the call
+	state     CallState
+	changedAt time.Time
+}
+
+// Caller returns the user that created the call
+func (c *Call) Caller() *User {
+	return c.From.user
+}
+
+// Recipient returns the user the call was made to
+func (c *Call) Recipient() *User {
+	return c.To.user
+}
+
+// Relayed returns true if both clients keep their websockets open once the call connects, so that signaling
+// messages are relayed between them until either hangs up. It may only be called once the answer was recieved.
+func (c *Call) Relayed() bool {
+	return c.From.Relays && c.To.Relays
+}
+
+// activeLocked returns true if the call hasn't ended. A call ends once it reaches a terminal state, except that
+// a relayed call is still active once connected, until either client hangs up. The lock of the CallMap
+// storing the call must be held.
+func (c *Call) activeLocked() bool {
+	if !c.state.Terminal() {
+		return true
+	}
+	if c.state != CallConnected || !c.Relayed() {
+		return false
+	}
+	select {
+	case <-c.hungUp:
+		return false
+	default:
+		return true
+	}
+}
+
+// HangUp ends a relayed call. It is safe to call more than once, and from either websocket handler.
+func (c *Call) HangUp() {
+	c.hangUp.Do(func() {
+		close(c.hungUp)
+	})
+}
+
+// HungUp returns a channel that is closed once either client of the call hangs up or disconnects
+func (c *Call) HungUp() <-chan struct{} {
+	return c.hungUp
 }
 
 // ClientInfo is the information about a webrtc client needed to create a call or a channel.
@@ -83,16 +345,28 @@ type ClientInfo struct {
 
 	// websockets will wait read from these to facilitate ICE trickle
 	Candidates chan webrtc.ICECandidateInit
+
+	// true if the client negotiated protocol.RelayVersion or later. The recipient's is set before its answer is
+	// sent on Call.Answer
+	Relays bool
 }
 
 // Create Call creates a struct encapsulating a pending call that is stored in memory
 // until the caller and recipient exchange all their ICE candidates. Channels in this
 // struct facilitate offer/answer and ICE exchance between the /call and /answer endpoints.
-func CreateCall(caller, recipient *User, callerSd webrtc.SessionDescription) *Call {
-	const maxICECandidates = 10 // should be enough?
+// ErrCallExists is returned if the caller already has a call that hasn't ended, and ErrRecipientBusy if the
+// recipient is in another call. callerRelays is true if the caller keeps its websocket open once the call connects.
+func CreateCall(caller, recipient *User, callerSd webrtc.SessionDescription, callerRelays bool) (*Call, error) {
+	const (
+		maxICECandidates = 10 // should be enough?
+
+		// signaling messages waiting to be relayed to a client, such as the candidates of an ICE restart
+		maxRelayed = 32
+	)
 	var (
 		// TODO: with channel rooms, these chans will need to be per-client
 		answerChan          = make(chan webrtc.SessionDescription, 1)
+		controlChan         = make(chan protocol.ControlType, 1)
 		callerCandidates    = make(chan webrtc.ICECandidateInit, maxICECandidates)
 		recipientCandidates = make(chan webrtc.ICECandidateInit, maxICECandidates)
 	)
@@ -100,6 +374,7 @@ func CreateCall(caller, recipient *User, callerSd webrtc.SessionDescription) *Ca
 		user:       caller,
 		Sd:         callerSd,
 		Candidates: callerCandidates,
+		Relays:     callerRelays,
 	}
 	recipientClient := ClientInfo{
 		user:       recipient,
@@ -107,14 +382,36 @@ func CreateCall(caller, recipient *User, callerSd webrtc.SessionDescription) *Ca
 		Candidates: recipientCandidates,
 	}
 
-	newCall := Call{
-		From:      callerClient,
-		To:        recipientClient,
-		CreatedAt: time.Now(),
-		Answer:    answerChan,
+	now := time.Now()
+	newCall := &Call{
+		Id:          uuid.New(),
+		From:        callerClient,
+		To:          recipientClient,
+		CreatedAt:   now,
+		Answer:      answerChan,
+		Control:     controlChan,
+		CallerLeft:  make(chan struct{}),
+		ToCaller:    make(chan protocol.Envelope, maxRelayed),
+		ToRecipient: make(chan protocol.Envelope, maxRelayed),
+		hungUp:      make(chan struct{}),
+		state:       CallCreated,
+		changedAt:   now,
 	}
+
 	// add this call to pending map, using caller's ID since a client can only make one call at a time
 	calls := GetPendingCalls()
-	calls.Update(caller.Id, newCall)
-	return &newCall
+	calls.mu.Lock()
+	if existing, exists := calls.calls[caller.Id]; exists && existing.activeLocked() {
+		calls.mu.Unlock()
+		return nil, ErrCallExists
+	}
+	if calls.busyLocked(recipient.Id) {
+		calls.mu.Unlock()
+		return nil, ErrRecipientBusy
+	}
+	calls.calls[caller.Id] = newCall
+	calls.mu.Unlock()
+
+	GetEvents().Publish(recipient.Id, public.Event{Type: public.EventIncomingCall, From: caller.Name})
+	return newCall, nil
 }
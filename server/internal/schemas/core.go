@@ -19,8 +19,11 @@ type User struct {
 type UserWithPassword struct {
 	User
 
-	// hashed password
+	// hashed password. empty if the user authenticates with a key pair
 	Password string
+
+	// ed25519 public key. nil if the user authenticates with a password
+	PublicKey []byte
 }
 
 // Channel is the database representation of public.Channel
@@ -30,3 +33,23 @@ type Channel struct {
 	Id        uuid.UUID
 	CreatedAt time.Time
 }
+
+// CallRecord is the database representation of public.CallRecord. A 1:1 call has a RecipientId,
+// and a visit to a channel's voice room has a ChannelId.
+type CallRecord struct {
+	public.CallRecord
+
+	Id       uuid.UUID
+	CallerId uuid.UUID
+	RecipientId,
+	ChannelId uuid.NullUUID
+}
+
+// SessionTTLs bound how long the tokens of a session are valid
+type SessionTTLs struct {
+	// how long a session token authenticates requests
+	Token time.Duration
+
+	// how long the session can be renewed for after it is created or last renewed
+	Refresh time.Duration
+}
@@ -0,0 +1,92 @@
+package schemas
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gregriff/vogo/server/internal/schemas/public"
+)
+
+// EventHub delivers events to the clients of users connected to GET /events.
+// A user may be connected from more than one client, and every client recieves every event.
+// Takes a user's UUID as a key
+type EventHub struct {
+	mu          sync.Mutex
+	subscribers map[uuid.UUID][]*Subscriber
+}
+
+// Subscriber is a client connected to GET /events. Events for the client are sent to Events,
+// which the client's websocket handler drains.
+type Subscriber struct {
+	userId uuid.UUID
+
+	Events chan public.Event
+}
+
+var (
+	eventHub       EventHub
+	createEventHub sync.Once
+)
+
+// GetEvents returns a singleton delivering events to connected clients
+func GetEvents() *EventHub {
+	createEventHub.Do(func() {
+		eventHub = EventHub{subscribers: make(map[uuid.UUID][]*Subscriber, 10)}
+	})
+	return &eventHub
+}
+
+// Subscribe adds a client of user to the hub. first is true if the user had no other clients connected.
+func (h *EventHub) Subscribe(user *User) (sub *Subscriber, first bool) {
+	const eventsSize = 16
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub = &Subscriber{userId: user.Id, Events: make(chan public.Event, eventsSize)}
+	first = len(h.subscribers[user.Id]) == 0
+	h.subscribers[user.Id] = append(h.subscribers[user.Id], sub)
+	return sub, first
+}
+
+// Unsubscribe removes a client from the hub
+func (h *EventHub) Unsubscribe(sub *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	subs := h.subscribers[sub.userId]
+	for i, s := range subs {
+		if s == sub {
+			subs = append(subs[:i], subs[i+1:]...)
+			break
+		}
+	}
+	if len(subs) == 0 {
+		delete(h.subscribers, sub.userId)
+		return
+	}
+	h.subscribers[sub.userId] = subs
+}
+
+// Online returns true if the user has a client connected
+func (h *EventHub) Online(userId uuid.UUID) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers[userId]) > 0
+}
+
+// Publish sends an event to every connected client of a user, setting its time.
+// Events are dropped for clients that are not connected or are not keeping up.
+func (h *EventHub) Publish(userId uuid.UUID, event public.Event) {
+	event.Time = time.Now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, sub := range h.subscribers[userId] {
+		select {
+		case sub.Events <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package public
+
+import "time"
+
+// Outcomes of a CallRecord
+const (
+	CallOutcomeAnswered = "answered"
+	CallOutcomeMissed   = "missed"
+	CallOutcomeDeclined = "declined"
+	CallOutcomeFailed   = "failed"
+)
+
+// CallRecord is an entry of a user's call history: a 1:1 call with a Recipient, or a visit to a Channel's voice room.
+// The server only sees an answered 1:1 call end if it relayed the call, so other answered calls have no EndedAt
+// or Duration.
+type CallRecord struct {
+	Caller string
+
+	Recipient string `json:",omitempty"`
+	Channel   string `json:",omitempty"`
+
+	// one of the CallOutcome constants
+	Outcome string
+
+	StartedAt time.Time
+	EndedAt   *time.Time `json:",omitempty"`
+
+	// seconds from when the call was answered until it ended, if the server saw it end
+	Duration *int `json:",omitempty"`
+}
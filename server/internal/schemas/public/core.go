@@ -4,6 +4,8 @@
 // records and other server-specific objects should embed these public structs.
 package public
 
+import "github.com/gregriff/vogo/protocol"
+
 // User stores information about the user of a vogo client
 type User struct {
 	// public username. should be unique (small groups), but might change
@@ -22,8 +24,18 @@ type Channel struct {
 	Name,
 	Description string
 
-	// Defaults to 6 (db enforced), due to WebRTC limitations
+	// Defaults to 6 (db enforced), due to WebRTC limitations of a full mesh
 	Capacity int
 
+	// one of the ChannelMode constants
+	Mode string
+
 	MemberNames string
 }
+
+// Modes of a channel's voice room, as described by the protocol package
+const (
+	ChannelModeMesh = protocol.ChannelModeMesh
+	ChannelModeSFU  = protocol.ChannelModeSFU
+	ChannelModeMCU  = protocol.ChannelModeMCU
+)
@@ -0,0 +1,37 @@
+package public
+
+import "time"
+
+// EventType identifies the kind of an Event
+type EventType string
+
+const (
+	// a friend is calling the client, who may answer with GET /answer/{name}
+	EventIncomingCall EventType = "incoming_call"
+
+	// a friend hung up before the client answered their call
+	EventCallCancelled EventType = "call_cancelled"
+
+	// a user sent the client a friend request, or accepted the client's request
+	EventFriendRequest  EventType = "friend_request"
+	EventFriendAccepted EventType = "friend_accepted"
+
+	// a friend connected to GET /events
+	EventFriendOnline EventType = "friend_online"
+
+	// the owner of a channel added the client to it
+	EventChannelInvite EventType = "channel_invite"
+)
+
+// Event is pushed by the server to a client connected to GET /events
+type Event struct {
+	Type EventType
+
+	// name of the user that caused the event
+	From string
+
+	// name of the channel, for EventChannelInvite
+	Channel string `json:",omitempty"`
+
+	Time time.Time
+}
@@ -1,7 +1,51 @@
 package public
 
+import (
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
 // StatusResponse is the http response for GET /status
 type StatusResponse struct {
 	Friends  []Friend
 	Channels []Channel
+
+	// calls to the user that were missed recently, newest first
+	MissedCalls []CallRecord
+
+	// the vogo server's STUN server, if it runs one
+	STUNServer string `json:",omitempty"`
+}
+
+// CallsResponse is the http response for GET /calls. More is true if older calls remain.
+type CallsResponse struct {
+	Calls []CallRecord
+	More  bool
+}
+
+// ICEServersResponse is the http response for GET /ice-servers
+type ICEServersResponse struct {
+	ICEServers []webrtc.ICEServer
+}
+
+// SessionResponse is the http response for POST /login and POST /refresh. Token is sent as a bearer token
+// with every other request until ExpiresAt, after which RefreshToken renews the session until RefreshExpiresAt.
+type SessionResponse struct {
+	Token,
+	RefreshToken string
+
+	ExpiresAt,
+	RefreshExpiresAt time.Time
+}
+
+// SessionsResponse is the http response for GET /sessions
+type SessionsResponse struct {
+	Sessions []Session
+}
+
+// ChallengeResponse is the http response for POST /challenge. The client signs the challenge with its
+// private key and sends it to POST /login.
+type ChallengeResponse struct {
+	Challenge string
 }
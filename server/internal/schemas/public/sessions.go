@@ -0,0 +1,21 @@
+package public
+
+import "time"
+
+// Session is a logged in client of a user, listed by GET /sessions
+type Session struct {
+	// used to revoke the session with DELETE /sessions/{id}
+	Id string
+
+	// name the client gave when logging in, usually its hostname
+	Device string
+
+	// address the session was last used from
+	IP string
+
+	CreatedAt,
+	LastUsedAt time.Time
+
+	// true for the session that made the request
+	Current bool
+}
@@ -1,39 +1,47 @@
 package schemas
 
-import (
-	"github.com/pion/webrtc/v4"
-)
-
-// NewUserRequest is the request data to register a new client with the server.
+// NewUserRequest is the request data to register a new client with the server. A Password,
+// a PublicKey or both may be given. PublicKey is a standard base64 ed25519 public key.
 type NewUserRequest struct {
 	Name,
 	Password,
+	PublicKey,
 	InviteCode string
 }
 
-type AddFriendRequest struct {
+// LoginRequest is the request data to create a session for a registered user. Either Password is given,
+// or a Challenge from POST /challenge and its base64 Signature made with the user's private key.
+// Device names the client in the user's list of sessions.
+type LoginRequest struct {
+	Name,
+	Password,
+	Challenge,
+	Signature,
+	Device string
+}
+
+// ChallengeRequest is the request data to begin logging in with a key pair
+type ChallengeRequest struct {
 	Name string
 }
 
-type InviteFriendRequest struct {
-	ChannelName,
-	FriendName string
+// RefreshRequest is the request data to renew a session before its refresh token expires
+type RefreshRequest struct {
+	RefreshToken string
 }
 
-// CallRequest is the request data used to create a call from one client to another.
-type CallRequest struct {
-	RecipientName string
-	Sd            webrtc.SessionDescription
+type AddFriendRequest struct {
+	Name string
 }
 
-// AnswerRequest is the request data used to answer a 1:1 voice call.
-type AnswerRequest struct {
-	CallerName string
-	Sd         webrtc.SessionDescription
+type InviteFriendRequest struct {
+	ChannelName,
+	FriendName string
 }
 
 type CreateChannelRequest struct {
 	Name,
-	Description string
+	Description,
+	Mode string
 	Capacity int
 }
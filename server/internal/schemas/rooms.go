@@ -0,0 +1,175 @@
+package schemas
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/gregriff/vogo/protocol"
+)
+
+var ErrAlreadyInRoom = errors.New("already in this channel's room")
+
+// RoomMap stores the voice rooms of channels that currently have members connected.
+// Rooms are created when the first member joins and deleted when the last member leaves.
+// Takes a channel's UUID as a key
+type RoomMap struct {
+	mu    sync.Mutex
+	rooms map[uuid.UUID]*Room
+}
+
+// Room is the in-memory state of a channel's voice room
+type Room struct {
+	channel *Channel
+
+	// members in the order they joined
+	members []*RoomMember
+}
+
+// RoomMember is a client connected to a Room. Messages for the client are sent to Outbox,
+// which the client's websocket handler drains. If the handler falls so far behind that the outbox fills,
+// the member is dropped rather than silently missing messages, and Dropped is closed.
+type RoomMember struct {
+	user *User
+
+	Outbox chan protocol.ChannelMessage
+
+	dropped  chan struct{}
+	dropOnce sync.Once
+}
+
+var (
+	rooms           RoomMap
+	createRoomStore sync.Once
+)
+
+// GetRooms returns a singleton storing the voice rooms of all channels
+func GetRooms() *RoomMap {
+	createRoomStore.Do(func() {
+		rooms = RoomMap{rooms: make(map[uuid.UUID]*Room, 10)}
+	})
+	return &rooms
+}
+
+// Join adds user to the room of channel, creating the room if needed, and notifies the members
+// already present. It returns the new member along with the names of the members already present,
+// or an error if the room is at the channel's capacity.
+func (m *RoomMap) Join(channel *Channel, user *User) (*RoomMember, []string, error) {
+	const outboxSize = 128 // offers and a burst of candidates from each other member
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	room, exists := m.rooms[channel.Id]
+	if !exists {
+		room = &Room{channel: channel, members: make([]*RoomMember, 0, channel.Capacity)}
+		m.rooms[channel.Id] = room
+	}
+	if room.find(user.Name) != nil {
+		return nil, nil, ErrAlreadyInRoom
+	}
+	if len(room.members) >= channel.Capacity {
+		return nil, nil, fmt.Errorf("channel %s is full (capacity %d)", channel.Name, channel.Capacity)
+	}
+
+	present := make([]string, 0, len(room.members))
+	for _, member := range room.members {
+		present = append(present, member.user.Name)
+		member.send(protocol.ChannelMessage{Type: protocol.ChannelJoined, From: user.Name})
+	}
+
+	newMember := &RoomMember{
+		user:    user,
+		Outbox:  make(chan protocol.ChannelMessage, outboxSize),
+		dropped: make(chan struct{}),
+	}
+	room.members = append(room.members, newMember)
+	return newMember, present, nil
+}
+
+// Leave removes a user from the room of a channel and notifies the remaining members.
+// The room is deleted once it is empty.
+func (m *RoomMap) Leave(channelId, userId uuid.UUID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	room, exists := m.rooms[channelId]
+	if !exists {
+		return
+	}
+
+	var name string
+	for i, member := range room.members {
+		if member.user.Id == userId {
+			name = member.user.Name
+			room.members = append(room.members[:i], room.members[i+1:]...)
+			break
+		}
+	}
+	if len(room.members) == 0 {
+		delete(m.rooms, channelId)
+		return
+	}
+	for _, member := range room.members {
+		member.send(protocol.ChannelMessage{Type: protocol.ChannelLeft, From: name})
+	}
+}
+
+// Forward sends a signaling message from a member to the member named in msg.To.
+// Only offers, answers and candidates may be forwarded.
+func (m *RoomMap) Forward(channelId uuid.UUID, from *User, msg protocol.ChannelMessage) error {
+	switch msg.Type {
+	case protocol.ChannelOffer, protocol.ChannelAnswer, protocol.ChannelCandidate:
+	default:
+		return fmt.Errorf("message type cannot be forwarded: %s", msg.Type)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	room, exists := m.rooms[channelId]
+	if !exists {
+		return errors.New("room not found")
+	}
+	to := room.find(msg.To)
+	if to == nil {
+		return fmt.Errorf("member not in room: %s", msg.To)
+	}
+
+	msg.From = from.Name
+	if !to.send(msg) {
+		return fmt.Errorf("outbox full, dropped member: %s", msg.To)
+	}
+	return nil
+}
+
+// find returns the member with the given name, or nil if they are not in the room
+func (r *Room) find(name string) *RoomMember {
+	for _, member := range r.members {
+		if member.user.Name == name {
+			return member
+		}
+	}
+	return nil
+}
+
+// send queues msg for the member without blocking, since the map's lock is held by callers.
+// If the member's outbox is full, the member is dropped and false is returned.
+func (rm *RoomMember) send(msg protocol.ChannelMessage) bool {
+	select {
+	case rm.Outbox <- msg:
+		return true
+	default:
+		rm.dropOnce.Do(func() {
+			close(rm.dropped)
+		})
+		return false
+	}
+}
+
+// Dropped returns a channel that is closed if the member missed a message because their outbox was full,
+// after which their handler should disconnect them
+func (rm *RoomMember) Dropped() <-chan struct{} {
+	return rm.dropped
+}
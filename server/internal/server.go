@@ -2,6 +2,7 @@ package internal
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"log"
@@ -13,28 +14,50 @@ import (
 
 	"github.com/gregriff/vogo/server/internal/db"
 	"github.com/gregriff/vogo/server/internal/middleware"
+	"github.com/gregriff/vogo/server/internal/relay"
 	"github.com/gregriff/vogo/server/internal/routes"
+	"github.com/gregriff/vogo/server/internal/schemas"
 	"golang.org/x/net/websocket"
 )
 
-func CreateAndListen(debug bool, host string, port int) {
+func CreateAndListen(
+	debug bool,
+	host string,
+	port int,
+	timeouts schemas.CallTimeouts,
+	ice relay.Config,
+	sessions schemas.SessionTTLs,
+) {
 	db := db.GetDB()
 	defer db.Close()
 
+	// the relay answers binding requests itself, so a STUN server on the same port isn't needed
+	if ice.STUNEnabled && !(ice.Enabled && ice.STUNPort == ice.Port) {
+		stunServer, err := relay.ListenSTUN(ice.STUNPort)
+		if err != nil {
+			log.Fatalf("stun server error: %v", err)
+		}
+		defer stunServer.Close()
+		log.Printf("Starting stun server on port %d", ice.STUNPort)
+	}
+	if ice.Enabled {
+		turnServer, err := relay.Listen(ice)
+		if err != nil {
+			log.Fatalf("turn relay error: %v", err)
+		}
+		defer turnServer.Close()
+		log.Printf("Starting turn relay on port %d", ice.Port)
+	}
+
 	// Initialize handlers with dependencies
-	h := routes.NewRouteHandler(db)
+	h := routes.NewRouteHandler(db, timeouts, ice, sessions)
 
-	mux := http.NewServeMux()
-	createRoutes(mux, h)
+	// expire calls whose handlers never cleaned them up
+	sweepCtx, stopSweep := context.WithCancel(context.Background())
+	defer stopSweep()
+	go schemas.GetPendingCalls().Sweep(sweepCtx, timeouts)
 
-	// apply middlewares
-	var handler http.Handler
-	if debug {
-		handler = middleware.DebugLogging(mux)
-	} else {
-		handler = mux
-	}
-	handler = middleware.BasicAuth(handler, db)
+	handler := NewHandler(debug, db, h)
 
 	server := &http.Server{
 		Addr:              fmt.Sprintf("%s:%d", host, port),
@@ -70,24 +93,57 @@ func CreateAndListen(debug bool, host string, port int) {
 	log.Println("Graceful shutdown complete.")
 }
 
+// NewHandler routes every endpoint of the vogo server to h, behind its middlewares
+func NewHandler(debug bool, db *sql.DB, h *routes.RouteHandler) http.Handler {
+	mux := http.NewServeMux()
+	createRoutes(mux, h)
+
+	// apply middlewares
+	var handler http.Handler
+	if debug {
+		handler = middleware.DebugLogging(mux)
+	} else {
+		handler = mux
+	}
+	return middleware.Auth(handler, db)
+}
+
 // createRoutes creates the routing rules for the webserver
 func createRoutes(mux *http.ServeMux, h *routes.RouteHandler) {
 	mux.HandleFunc("POST /register", h.Register)
+	mux.HandleFunc("POST /challenge", h.Challenge)
+	mux.HandleFunc("POST /login", h.Login)
+	mux.HandleFunc("POST /refresh", h.Refresh)
+	mux.HandleFunc("POST /logout", h.Logout)
+	mux.HandleFunc("GET /sessions", h.Sessions)
+	mux.HandleFunc("DELETE /sessions/{id}", h.RevokeSession)
 	mux.HandleFunc("GET /status", h.Status)
 	mux.HandleFunc("POST /friend", h.AddFriend)
 	mux.HandleFunc("POST /channel", h.CreateChannel)
 	mux.HandleFunc("POST /invite", h.InviteFriend)
+	mux.HandleFunc("GET /calls", h.Calls)
+	mux.HandleFunc("GET /ice-servers", h.ICEServers)
 
 	callHandler := websocket.Server{
-		Handshake: websocketHandshake,
+		Handshake: routes.SignalingHandshake,
 		Handler:   h.Call,
 	}
 	answerHandler := websocket.Server{
-		Handshake: websocketHandshake,
+		Handshake: routes.SignalingHandshake,
 		Handler:   h.Answer,
 	}
+	joinHandler := websocket.Server{
+		Handshake: routes.ChannelHandshake,
+		Handler:   h.Join,
+	}
 	mux.Handle("GET /call", callHandler)
 	mux.Handle("GET /answer/{name}", answerHandler)
+	eventsHandler := websocket.Server{
+		Handshake: websocketHandshake,
+		Handler:   h.Events,
+	}
+	mux.Handle("GET /channel/{name}/join", joinHandler)
+	mux.Handle("GET /events", eventsHandler)
 }
 
 func websocketHandshake(_ *websocket.Config, _ *http.Request) error { return nil }
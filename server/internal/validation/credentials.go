@@ -8,14 +8,16 @@ import (
 	"net/http"
 	"regexp"
 
+	"github.com/gregriff/vogo/server/internal/crypto"
 	"github.com/gregriff/vogo/server/internal/dal"
 )
 
 var validCharsUsername = regexp.MustCompile(`^[A-Za-z\d@$!%*?&]+$`)
 var validCharsPassword = regexp.MustCompile(`^[A-Za-z\d@$!%*?&#]+$`)
 
-// CheckRegistrationCredentials validates user credentials during registration
-func CheckRegistrationCredentials(db *sql.DB, inviteCode, username, password string) (error, int) {
+// CheckRegistrationCredentials validates user credentials during registration. A user
+// needs a password, a public key, or both.
+func CheckRegistrationCredentials(db *sql.DB, inviteCode, username, password, publicKey string) (error, int) {
 	if vErr := dal.ValidateInviteCode(db, inviteCode); vErr != nil {
 		log.Printf("invite code validation error: %v", vErr)
 		return errors.New("invalid invite code"), http.StatusUnauthorized
@@ -23,6 +25,14 @@ func CheckRegistrationCredentials(db *sql.DB, inviteCode, username, password str
 	if vErr := validateUsername(username); vErr != nil {
 		return fmt.Errorf("invalid username %s (%w)", username, vErr), http.StatusBadRequest
 	}
+	if publicKey != "" {
+		if _, vErr := crypto.ParsePublicKey(publicKey); vErr != nil {
+			return fmt.Errorf("invalid public key (%w)", vErr), http.StatusBadRequest
+		}
+		if password == "" {
+			return nil, http.StatusOK
+		}
+	}
 	if vErr := validatePassword(password); vErr != nil {
 		return fmt.Errorf("invalid password (%w)", vErr), http.StatusBadRequest
 	}
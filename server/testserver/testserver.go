@@ -0,0 +1,109 @@
+// package testserver runs a vogo server in-process, for end-to-end tests of clients against it
+package testserver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand/v2"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gregriff/vogo/server/internal"
+	"github.com/gregriff/vogo/server/internal/crypto"
+	"github.com/gregriff/vogo/server/internal/dal"
+	"github.com/gregriff/vogo/server/internal/db"
+	"github.com/gregriff/vogo/server/internal/relay"
+	"github.com/gregriff/vogo/server/internal/routes"
+	"github.com/gregriff/vogo/server/internal/schemas"
+)
+
+// Server is a vogo server listening on a loopback address, at URL
+type Server struct {
+	*httptest.Server
+
+	db        *sql.DB
+	stopSweep context.CancelFunc
+}
+
+// the timeouts of 1:1 calls, matching the defaults of vogo-server
+var timeouts = schemas.CallTimeouts{
+	Ring:   30 * time.Second,
+	Answer: 15 * time.Second,
+	Sweep:  5 * time.Second,
+}
+
+// New starts a vogo server with a new postgres database on the server set by the PG environment variables,
+// which is dropped once the test ends, along with everything the test created in it. The test is skipped if
+// the database can't be created, and the server is closed once the test ends. The server has no STUN or TURN
+// servers, so clients only connect with host candidates.
+func New(t testing.TB) *Server {
+	t.Helper()
+	name := createDatabase(t)
+	database, err := db.OpenDatabase(name)
+	if err != nil {
+		t.Fatalf("error opening test database: %v", err)
+	}
+
+	h := routes.NewRouteHandler(database, timeouts, relay.Config{}, schemas.SessionTTLs{
+		Token:   time.Hour,
+		Refresh: time.Hour,
+	})
+	sweepCtx, stopSweep := context.WithCancel(context.Background())
+	go schemas.GetPendingCalls().Sweep(sweepCtx, timeouts)
+
+	s := &Server{
+		Server:    httptest.NewServer(internal.NewHandler(testing.Verbose(), database, h)),
+		db:        database,
+		stopSweep: stopSweep,
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Close shuts down the server and closes its database
+func (s *Server) Close() {
+	s.Server.Close()
+	s.stopSweep()
+	_ = s.db.Close()
+}
+
+// createDatabase creates a database for a single test, which is dropped once the test ends, and returns its name.
+// The test is skipped if postgres can't be reached or doesn't allow creating databases.
+func createDatabase(t testing.TB) string {
+	t.Helper()
+	admin, err := sql.Open("pgx", "") // use PG env vars to set the server
+	if err != nil {
+		t.Skipf("skipping without a database: %v", err)
+	}
+	if err = admin.Ping(); err != nil {
+		_ = admin.Close()
+		t.Skipf("skipping without a database: %v", err)
+	}
+
+	name := fmt.Sprintf("vogo_test_%d", rand.Uint32())
+	if _, err = admin.Exec("CREATE DATABASE " + name); err != nil {
+		_ = admin.Close()
+		t.Skipf("skipping without permission to create a database: %v", err)
+	}
+
+	// registered before the server is closed, so that it runs after
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP DATABASE IF EXISTS " + name + " WITH (FORCE)"); err != nil {
+			t.Errorf("error dropping test database %s: %v", name, err)
+		}
+		_ = admin.Close()
+	})
+	return name
+}
+
+// InviteCode creates an invite code for registering a user, failing the test if it can't
+func (s *Server) InviteCode(t testing.TB) string {
+	t.Helper()
+	code := crypto.GenerateInviteCode()
+	if err := dal.AddInviteCode(s.db, code); err != nil {
+		t.Fatalf("error creating invite code: %v", err)
+	}
+	return code
+}